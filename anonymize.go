@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/google/subcommands"
+
+	"xtool/anonymize"
+	"xtool/exif"
+	"xtool/stash"
+)
+
+type anonymizeCmd struct {
+	restore        bool
+	encrypt        bool
+	passphraseFile string
+	suffix         bool
+	outDir         string
+	verbose        bool
+	verbose2       bool
+	appConfig      AppConfig
+}
+
+func (*anonymizeCmd) Name() string { return "anonymize" }
+func (*anonymizeCmd) Synopsis() string {
+	return "Remove metadata identifying the photographer or their equipment."
+}
+
+func (*anonymizeCmd) Usage() string {
+	return `anonymize [-r] [-encrypt] [-passphrase-file FILE] [-s] [-d out_dir] [-v|-vv] file1.jpg [file2.nef ...]:
+  Strips identifying metadata from the given files: camera & lens serial numbers, owner and
+  artist names, software strings, unique image IDs, and maker-note identifiers. Tags listed in
+  anonymize_replacements are replaced with the configured values rather than removed.
+  Persists the original values in an XMP attribute for restoration with the -r flag. With -encrypt,
+  the original values are encrypted with a passphrase, read from the passphrase file or the
+  ` + stash.PassphraseEnvVar + ` environment variable; the same passphrase is required to restore them.
+  Without -encrypt, anyone with the file can read the original values, so use -encrypt for files
+  you'll share.
+  Tags covered: ` + strings.Join(anonymize.Tags, ", ") + `
+`
+}
+
+func (p *anonymizeCmd) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&p.suffix, "s", false, "Write modified images to new files named with the suffix _anon (or _unanon with -r), rather than to the originals.")
+	f.StringVar(&p.outDir, "d", "", "Write modified images to this directory.")
+	f.BoolVar(&p.verbose, "v", false, "Print full exiftool output for each image.")
+	f.BoolVar(&p.verbose2, "vv", false, "Print exiftool commands and full exiftool output.")
+
+	f.BoolVar(&p.restore, "r", false, "Restore the original metadata, using xtool's XMP attributes.")
+	f.BoolVar(&p.encrypt, "encrypt", false, "Encrypt the stashed original metadata with a passphrase.")
+	f.StringVar(&p.passphraseFile, "passphrase-file", "", "Read the passphrase from this file, rather than from $"+stash.PassphraseEnvVar+".")
+}
+
+func (p *anonymizeCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if p.verbose2 {
+		p.verbose = true
+	}
+
+	if len(f.Args()) == 0 || (p.restore && p.encrypt) {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	p.appConfig = AppConfigFromCtx(ctx)
+
+	passphrase, err := stash.Passphrase(p.passphraseFile)
+	if err != nil {
+		ErrPrint(ctx, err)
+		return subcommands.ExitFailure
+	}
+	if p.encrypt && passphrase == "" {
+		ErrPrintln(ctx, stash.ErrNoPassphrase.Error())
+		return subcommands.ExitFailure
+	}
+	if !p.encrypt && !p.restore {
+		passphrase = ""
+	}
+
+	et, err := newExiftool(p.appConfig, p.verbose2)
+	if err != nil {
+		ErrPrint(ctx, err)
+		return subcommands.ExitFailure
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer func() { _ = et.Close() }()
+
+	opts := anonymize.Options{
+		Output:       exif.Output{Dir: p.outDir, Suffix: p.suffix},
+		Replacements: p.appConfig.AnonymizeReplacements,
+		Passphrase:   passphrase,
+	}
+	process := func(imgFilename string, startTime time.Time) exif.Result {
+		return anonymize.Anonymize(ctx, et, imgFilename, opts, startTime)
+	}
+	if p.restore {
+		process = func(imgFilename string, startTime time.Time) exif.Result {
+			return anonymize.Restore(ctx, et, imgFilename, opts, startTime)
+		}
+	}
+
+	successes, failures := ExiftoolProcess(ctx, f.Args(), p.verbose, p.verbose2, process)
+
+	boldWhitePrintf := color.New(color.Bold, color.FgWhite).PrintfFunc()
+	boldRedPrintf := color.New(color.Bold, color.FgRed).PrintfFunc()
+
+	boldWhitePrintf("\nanonymize: successfully processed %d images.\n", len(successes))
+	if skipped := len(f.Args()) - len(successes) - len(failures); skipped > 0 {
+		boldWhitePrintf("anonymize: skipped %d images.\n", skipped)
+	}
+
+	if len(failures) != 0 {
+		boldRedPrintf("Errors:\n")
+		for filename, err := range failures {
+			fmt.Printf("- %s %s\n", color.MagentaString("%s:", filename), err)
+		}
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,229 @@
+// Package anonymize strips or replaces metadata that identifies the photographer or their
+// equipment: serial numbers, owner and artist names, software strings, unique image IDs, and
+// maker-note identifiers. The original values are stashed in an xtool XMP tag, optionally
+// encrypted with a passphrase, so they can be restored later.
+package anonymize
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"xtool/exif"
+	"xtool/stash"
+)
+
+var (
+	ErrNotAnonymized     = errors.New("no anonymize metadata attached")
+	ErrAlreadyAnonymized = errors.New("already anonymized; restore it with anonymize -r before anonymizing it again")
+)
+
+// Tags anonymize strips or replaces, grouped by what they reveal. Writing a tag by name updates
+// every group (EXIF, IPTC, XMP, maker notes) the tag exists in.
+var (
+	SerialNumberTags = []string{"SerialNumber", "InternalSerialNumber", "LensSerialNumber", "CameraSerialNumber"}
+	OwnerTags        = []string{"Artist", "OwnerName", "Creator", "By-line", "XPAuthor"}
+	SoftwareTags     = []string{"Software", "ProcessingSoftware", "CreatorTool", "HostComputer"}
+	ImageIDTags      = []string{
+		"ImageUniqueID", "DocumentID", "OriginalDocumentID", "InstanceID",
+		"DerivedFromDocumentID", "DerivedFromOriginalDocumentID", "DerivedFromInstanceID",
+	}
+	MakerNoteIDTags = []string{
+		"CameraID",                                         // Olympus
+		"ContentIdentifier", "MediaGroupUUID", "BurstUUID", // Apple: link a photo to its Live Photo video and burst
+	}
+)
+
+// Tags lists every tag anonymize strips or replaces.
+var Tags = slices.Concat(SerialNumberTags, OwnerTags, SoftwareTags, ImageIDTags, MakerNoteIDTags)
+
+// IsTag reports whether name is one of Tags.
+func IsTag(name string) bool {
+	return slices.Contains(Tags, name)
+}
+
+// Originals maps group-qualified tag names (eg. "IFD0:Artist") to their values.
+type Originals map[string][]string
+
+// State is a file's anonymize metadata.
+type State struct {
+	Current map[string][]string // current values of Tags, keyed by group-qualified tag name
+	Stash   string              // the stashed originals; empty if the file hasn't been anonymized
+}
+
+func (s State) Anonymized() bool {
+	return s.Stash != ""
+}
+
+// Encrypted reports whether the stashed originals are encrypted.
+func (s State) Encrypted() bool {
+	return stash.IsEncrypted(s.Stash)
+}
+
+// Originals decodes the stashed originals, decrypting them with passphrase if necessary.
+func (s State) Originals(passphrase string) (Originals, error) {
+	if !s.Anonymized() {
+		return nil, ErrNotAnonymized
+	}
+	originalsJSON := []byte(s.Stash)
+	if s.Encrypted() {
+		var err error
+		if originalsJSON, err = stash.Decrypt(s.Stash, passphrase); err != nil {
+			return nil, fmt.Errorf("failed to decrypt stashed originals: %w", err)
+		}
+	}
+	var originals Originals
+	if err := json.Unmarshal(originalsJSON, &originals); err != nil {
+		return nil, fmt.Errorf("failed to parse stashed originals: %w", err)
+	}
+	return originals, nil
+}
+
+// presentTags returns the names of Tags the file currently has a value for.
+func (s State) presentTags() []string {
+	var tags []string
+	for _, tag := range Tags {
+		for key := range s.Current {
+			if exif.TagName(key) == tag {
+				tags = append(tags, tag)
+				break
+			}
+		}
+	}
+	return tags
+}
+
+// StateArgs returns the exiftool arguments that read the tags StateFromMetadata needs.
+func StateArgs() []string {
+	args := []string{"-a", "-G1", "-" + exif.TagAnonymizedOriginals}
+	for _, tag := range Tags {
+		args = append(args, "-"+tag)
+	}
+	return args
+}
+
+// StateFromMetadata returns the anonymize state recorded in a file's metadata, which must have
+// been read with StateArgs.
+func StateFromMetadata(m exif.Metadata) State {
+	state := State{Current: make(map[string][]string)}
+	for key := range m {
+		name := exif.TagName(key)
+		if name == exif.TagAnonymizedOriginals {
+			state.Stash, _ = m.String(key)
+		} else if IsTag(name) {
+			state.Current[key] = m.Strings(key)
+		}
+	}
+	return state
+}
+
+// ReadState reads file's anonymize state.
+func ReadState(ctx context.Context, et *exif.Exiftool, file string) (State, error) {
+	result, err := et.ReadJSON(ctx, StateArgs(), file)
+	if err != nil {
+		return State{}, err
+	}
+	if len(result) != 1 {
+		return State{}, fmt.Errorf("invalid exiftool output: expected 1 item, got %d", len(result))
+	}
+	return StateFromMetadata(result[0]), nil
+}
+
+// Options control how Anonymize and Restore modify files.
+type Options struct {
+	Output       exif.Output
+	Replacements map[string]string // replacement values for Tags; tags without a replacement are removed
+	Passphrase   string            // if set, the stashed originals are encrypted with this passphrase
+}
+
+// AnonymizeArgs returns the exiftool arguments that anonymize a file with the given state.
+// It returns nil if the file has none of Tags.
+func AnonymizeArgs(state State, opts Options) ([]string, error) {
+	if state.Anonymized() {
+		return nil, ErrAlreadyAnonymized
+	}
+	tags := state.presentTags()
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	originalsJSON, err := json.Marshal(Originals(state.Current))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode originals: %w", err)
+	}
+	stashValue := string(originalsJSON)
+	if opts.Passphrase != "" {
+		if stashValue, err = stash.Encrypt(originalsJSON, opts.Passphrase); err != nil {
+			return nil, fmt.Errorf("failed to encrypt originals: %w", err)
+		}
+	}
+
+	exiftoolArgs := []string{fmt.Sprintf("-%s=%s", exif.TagAnonymizedOriginals, stashValue)}
+	for _, tag := range tags {
+		exiftoolArgs = append(exiftoolArgs, fmt.Sprintf("-%s=%s", tag, opts.Replacements[tag]))
+	}
+	return append(exiftoolArgs, opts.Output.Args("anon")...), nil
+}
+
+// RestoreArgs returns the exiftool arguments that restore the original values stashed in a file
+// with the given state, removing any replacement values and the stash.
+func RestoreArgs(state State, opts Options) ([]string, error) {
+	originals, err := state.Originals(opts.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var exiftoolArgs []string
+	for _, tag := range state.presentTags() {
+		exiftoolArgs = append(exiftoolArgs, "-"+tag+"=")
+	}
+	keys := make([]string, 0, len(originals))
+	for key := range originals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// assigning a list-type tag multiple times in one command sets the list to all the assigned values:
+		for _, value := range originals[key] {
+			exiftoolArgs = append(exiftoolArgs, fmt.Sprintf("-%s=%s", key, value))
+		}
+	}
+	exiftoolArgs = append(exiftoolArgs, "-"+exif.TagAnonymizedOriginals+"=")
+	return append(exiftoolArgs, opts.Output.Args("unanon")...), nil
+}
+
+// Anonymize strips or replaces the identifying tags in file, stashing their original values.
+// A file with no identifying tags is skipped. See exif.Exiftool.ProcessFile for how backups are handled.
+func Anonymize(ctx context.Context, et *exif.Exiftool, file string, opts Options, startTime time.Time) exif.Result {
+	state, err := ReadState(ctx, et, file)
+	if err != nil {
+		return exif.Result{File: file, Err: err}
+	}
+	exiftoolArgs, err := AnonymizeArgs(state, opts)
+	if err != nil {
+		return exif.Result{File: file, Err: err}
+	}
+	if exiftoolArgs == nil {
+		return exif.Result{File: file, SkipReason: "no identifying metadata found"}
+	}
+	return et.ProcessFile(ctx, exiftoolArgs, file, startTime)
+}
+
+// Restore restores the original values stashed in file by Anonymize. opts.Passphrase must be
+// the passphrase the originals were encrypted with, if they were.
+// It fails with ErrNotAnonymized if the file has not been anonymized.
+func Restore(ctx context.Context, et *exif.Exiftool, file string, opts Options, startTime time.Time) exif.Result {
+	state, err := ReadState(ctx, et, file)
+	if err != nil {
+		return exif.Result{File: file, Err: err}
+	}
+	exiftoolArgs, err := RestoreArgs(state, opts)
+	if err != nil {
+		return exif.Result{File: file, Err: err}
+	}
+	return et.ProcessFile(ctx, exiftoolArgs, file, startTime)
+}
@@ -0,0 +1,138 @@
+package anonymize
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"xtool/exif"
+	"xtool/stash"
+)
+
+const stashArgPrefix = "-" + exif.TagAnonymizedOriginals + "="
+
+func TestAnonymizeArgs(t *testing.T) {
+	current := map[string][]string{
+		"IFD0:Artist":          {"Jane Doe"},
+		"ExifIFD:SerialNumber": {"2001234"},
+		"XMP-dc:Creator":       {"Jane Doe", "John Doe"},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		state   State
+		opts    Options
+		want    []string // the args after the stash
+		wantErr error
+	}{
+		{
+			name:  "removals",
+			state: State{Current: current},
+			want:  []string{"-SerialNumber=", "-Artist=", "-Creator="},
+		},
+		{
+			name:  "replacements and output",
+			state: State{Current: current},
+			opts: Options{
+				Replacements: map[string]string{"Artist": "Anonymous", "Creator": "Anonymous"},
+				Output:       exif.Output{Suffix: true},
+			},
+			want: []string{"-SerialNumber=", "-Artist=Anonymous", "-Creator=Anonymous", "-o", "%d%f_anon.%e"},
+		},
+		{
+			name:  "no identifying tags",
+			state: State{Current: map[string][]string{}},
+		},
+		{
+			name:    "already anonymized",
+			state:   State{Current: current, Stash: `{"IFD0:Artist":["Jane Doe"]}`},
+			wantErr: ErrAlreadyAnonymized,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := AnonymizeArgs(tc.state, tc.opts)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("AnonymizeArgs() error = %v; want %v", err, tc.wantErr)
+			}
+			if tc.want == nil {
+				if got != nil {
+					t.Errorf("AnonymizeArgs() = %q; want nil", got)
+				}
+				return
+			}
+			if len(got) == 0 || !strings.HasPrefix(got[0], stashArgPrefix) {
+				t.Fatalf("AnonymizeArgs() = %q; want the stash first", got)
+			}
+			if !slices.Equal(got[1:], tc.want) {
+				t.Errorf("AnonymizeArgs() = %q; want the stash followed by %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStashRoundTrip(t *testing.T) {
+	current := map[string][]string{
+		"IFD0:Artist":          {"Jane Doe"},
+		"ExifIFD:SerialNumber": {"2001234"},
+		"XMP-dc:Creator":       {"Jane Doe", "John Doe"},
+	}
+	replacements := map[string]string{"Artist": "Anonymous"}
+	wantRestore := []string{
+		"-Artist=",
+		"-ExifIFD:SerialNumber=2001234",
+		"-IFD0:Artist=Jane Doe",
+		"-XMP-dc:Creator=Jane Doe", "-XMP-dc:Creator=John Doe",
+		"-" + exif.TagAnonymizedOriginals + "=",
+		"-o", "%d%f_unanon.%e",
+	}
+
+	for _, tc := range []struct {
+		name              string
+		passphrase        string
+		restorePassphrase string
+		wantEncrypted     bool
+		wantErr           bool
+	}{
+		{name: "plaintext"},
+		{name: "plaintext, restored with a passphrase", restorePassphrase: "hunter2"},
+		{name: "encrypted", passphrase: "hunter2", restorePassphrase: "hunter2", wantEncrypted: true},
+		{name: "encrypted, wrong passphrase", passphrase: "hunter2", restorePassphrase: "hunter3", wantEncrypted: true, wantErr: true},
+		{name: "encrypted, no passphrase", passphrase: "hunter2", wantEncrypted: true, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			anonArgs, err := AnonymizeArgs(State{Current: current}, Options{Replacements: replacements, Passphrase: tc.passphrase})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// what exiftool would then report for the anonymized file:
+			stashValue := strings.TrimPrefix(anonArgs[0], stashArgPrefix)
+			state := StateFromMetadata(exif.Metadata{
+				"IFD0:Artist": "Anonymous",
+				"XMP-xtool:" + exif.TagAnonymizedOriginals: stashValue,
+			})
+			if !state.Anonymized() {
+				t.Fatal("Anonymized() = false; want true")
+			}
+			if state.Encrypted() != tc.wantEncrypted || stash.IsEncrypted(stashValue) != tc.wantEncrypted {
+				t.Errorf("Encrypted() = %v; want %v", state.Encrypted(), tc.wantEncrypted)
+			}
+			if tc.wantEncrypted && strings.Contains(stashValue, "Jane Doe") {
+				t.Errorf("encrypted stash %q contains an original value", stashValue)
+			}
+
+			got, err := RestoreArgs(state, Options{Passphrase: tc.restorePassphrase, Output: exif.Output{Suffix: true}})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("RestoreArgs() error = %v; want error: %v", err, tc.wantErr)
+			}
+			if err == nil && !slices.Equal(got, wantRestore) {
+				t.Errorf("RestoreArgs() = %q; want %q", got, wantRestore)
+			}
+		})
+	}
+
+	if _, err := RestoreArgs(State{Current: current}, Options{}); !errors.Is(err, ErrNotAnonymized) {
+		t.Errorf("RestoreArgs() on a file that isn't anonymized: error = %v; want %v", err, ErrNotAnonymized)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/google/subcommands"
+
+	"xtool/audit"
+)
+
+type auditCmd struct {
+	format     string
+	reportPath string
+	appConfig  AppConfig
+}
+
+func (*auditCmd) Name() string     { return "audit" }
+func (*auditCmd) Synopsis() string { return "Scan a folder for privacy-compromising metadata." }
+
+func (*auditCmd) Usage() string {
+	return `audit [-o html|json] [-report report_file] DIR|file1.jpg [DIR2|file2.nef ...]:
+  Scans the image files in the given folders (and their subfolders) and files, without modifying
+  them, and reports files with GPS locations, serial numbers, owner names, face regions, embedded
+  thumbnails that differ from the image (JPEGs only), software history, or camswapped identities
+  whose originals are still embedded. Prints a count of files in each category, and writes the
+  full report as HTML or JSON to the report file (or to stdout, if -report isn't given).
+`
+}
+
+func (p *auditCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&p.format, "o", "html", "Report format: "+strings.Join(audit.Formats, ", ")+".")
+	f.StringVar(&p.reportPath, "report", "", "Write the report to this file, rather than to stdout.")
+}
+
+func (p *auditCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if len(f.Args()) == 0 || !slices.Contains(audit.Formats, p.format) {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	p.appConfig = AppConfigFromCtx(ctx)
+
+	var files []string
+	for _, root := range f.Args() {
+		rootFiles, err := auditFiles(root)
+		if err != nil {
+			ErrPrint(ctx, err)
+			return subcommands.ExitFailure
+		}
+		files = append(files, rootFiles...)
+	}
+
+	et, err := newExiftool(p.appConfig, false)
+	if err != nil {
+		ErrPrint(ctx, err)
+		return subcommands.ExitFailure
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer func() { _ = et.Close() }()
+
+	report := audit.Audit(ctx, et, f.Args(), files)
+
+	// print the summary where it won't mix with the report:
+	var summaryOut io.Writer = os.Stdout
+	reportOut := os.Stdout
+	if p.reportPath == "" {
+		summaryOut = os.Stderr
+	} else {
+		if reportOut, err = os.Create(p.reportPath); err != nil {
+			ErrPrintf(ctx, "failed to create report file: %s\n", err)
+			return subcommands.ExitFailure
+		}
+	}
+	if err := audit.Write(reportOut, p.format, report); err != nil {
+		ErrPrintf(ctx, "failed to write report: %s\n", err)
+		if p.reportPath != "" {
+			_ = reportOut.Close()
+		}
+		return subcommands.ExitFailure
+	}
+	if p.reportPath != "" {
+		if err := reportOut.Close(); err != nil {
+			ErrPrintf(ctx, "failed to write report: %s\n", err)
+			return subcommands.ExitFailure
+		}
+	}
+
+	boldWhite := color.New(color.Bold, color.FgWhite)
+	_, _ = boldWhite.Fprintf(summaryOut, "\naudit: scanned %d images.\n", report.FilesScanned)
+	for _, c := range audit.Categories {
+		count := color.GreenString("%d", report.Counts[c.ID])
+		if report.Counts[c.ID] != 0 {
+			count = color.RedString("%d", report.Counts[c.ID])
+		}
+		_, _ = fmt.Fprintf(summaryOut, "%s %s\n", color.MagentaString("%s:", c.Label), count)
+	}
+	if report.Errors != 0 {
+		_, _ = fmt.Fprintf(summaryOut, "%s %s\n", color.MagentaString("Unreadable files:"), color.RedString("%d", report.Errors))
+	}
+	if p.reportPath != "" {
+		_, _ = boldWhite.Fprintf(summaryOut, "audit: wrote report to %s\n", p.reportPath)
+	}
+
+	return subcommands.ExitSuccess
+}
+
+// auditFiles returns the image files in root, which may be a folder or a single file.
+// Hidden files and folders are skipped.
+func auditFiles(root string) ([]string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{root}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && slices.Contains(imageExtensions, strings.ToLower(filepath.Ext(path))) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan '%s': %w", root, err)
+	}
+	return files, nil
+}
@@ -0,0 +1,215 @@
+// Package audit scans image files, without modifying them, for metadata that may compromise the
+// photographer's or their subjects' privacy: GPS locations, serial numbers, owner names, face
+// regions, stale embedded thumbnails, software history, and camswapped files still carrying
+// their original identity.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"xtool/anonymize"
+	"xtool/camswap"
+	"xtool/exif"
+	"xtool/inspect"
+	"xtool/rmloc"
+)
+
+// Category is a kind of privacy-relevant metadata.
+type Category struct {
+	ID          string `json:"id"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+}
+
+// Categories lists every category audit checks for, in report order.
+var Categories = []Category{
+	{ID: "gps", Label: "GPS location", Description: "GPS coordinates reveal where the photo was taken. Remove them with rmloc."},
+	{ID: "serial_numbers", Label: "Serial numbers", Description: "Camera and lens serial numbers link photos to each other and to their owner. Remove them with anonymize."},
+	{ID: "owner_names", Label: "Owner names", Description: "Artist, owner, and creator names identify the photographer. Remove them with anonymize."},
+	{ID: "face_regions", Label: "Face regions", Description: "Tagged face regions may name the people in the photo."},
+	{ID: "stale_thumbnails", Label: "Stale thumbnails", Description: "An embedded thumbnail that differs from the image may show content that was cropped or edited out of it. Replace it with rmloc -deep -regen-previews."},
+	{ID: "software", Label: "Software history", Description: "Software, editing history, and host computer names reveal the photographer's tools and computers. Remove them with anonymize."},
+	{ID: "camswap_originals", Label: "Camswap originals", Description: "Camswapped files still carry the original camera identity in xtool's XMP attributes."},
+}
+
+// historySoftwareTag is the XMP editing history's record of the software used for each edit.
+const historySoftwareTag = "HistorySoftwareAgent"
+
+// faceRegionTags are the MWG and Microsoft Photo face region tags.
+var faceRegionTags = []string{"RegionType", "RegionName", "RegionPersonDisplayName"}
+
+// Finding is one privacy-relevant item found in a file.
+type Finding struct {
+	Category string `json:"category"` // a Categories ID
+	Detail   string `json:"detail"`
+}
+
+// FileReport lists the findings in one file.
+type FileReport struct {
+	File     string    `json:"file"`
+	Error    string    `json:"error,omitempty"` // set if the file couldn't be read
+	Findings []Finding `json:"findings"`
+}
+
+// Report is the result of an audit.
+type Report struct {
+	GeneratedAt  time.Time      `json:"generated_at"`
+	Roots        []string       `json:"roots"`         // the directories and files audited
+	FilesScanned int            `json:"files_scanned"` // files read, including those that couldn't be read
+	Counts       map[string]int `json:"counts"`        // number of files with findings in each category, by Categories ID
+	Errors       int            `json:"errors"`        // number of files that couldn't be read
+	Files        []FileReport   `json:"files"`         // files with findings or errors
+}
+
+// FilesIn returns the files in r with findings in the given category.
+func (r Report) FilesIn(category string) []FileReport {
+	var files []FileReport
+	for _, f := range r.Files {
+		if slices.ContainsFunc(f.Findings, func(finding Finding) bool { return finding.Category == category }) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// args returns the exiftool arguments that read the tags fileReport needs.
+func args() []string {
+	args := inspect.Args(inspect.Options{Swap: true, Location: true})
+	for _, tag := range slices.Concat(anonymize.SerialNumberTags, anonymize.OwnerTags, anonymize.SoftwareTags, faceRegionTags) {
+		args = append(args, "-"+tag)
+	}
+	// -b includes the thumbnail image in the JSON output, base64-encoded:
+	return append(args, "-"+historySoftwareTag, "-b", "-ThumbnailImage")
+}
+
+// Audit reads the given files' metadata, without modifying them, and reports their findings.
+// roots are recorded in the report as the directories and files the files were found in.
+func Audit(ctx context.Context, et *exif.Exiftool, roots []string, files []string) Report {
+	report := Report{
+		GeneratedAt:  time.Now(),
+		Roots:        roots,
+		FilesScanned: len(files),
+		Counts:       make(map[string]int),
+		Files:        []FileReport{},
+	}
+	for _, c := range Categories {
+		report.Counts[c.ID] = 0
+	}
+
+	exiftoolArgs := args()
+	for len(files) != 0 {
+		batch := files[:min(len(files), inspect.BatchSize)]
+		files = files[len(batch):]
+
+		metadata, errs, batchErr := et.ReadJSONEach(ctx, exiftoolArgs, batch)
+		for _, file := range batch {
+			err := batchErr
+			if err == nil {
+				err = errs[file]
+			}
+			var fileReport FileReport
+			if err != nil {
+				fileReport = FileReport{File: file, Error: err.Error()}
+				report.Errors++
+			} else {
+				fileReport = fileReportFor(file, metadata[file])
+			}
+			if fileReport.Error == "" && len(fileReport.Findings) == 0 {
+				continue
+			}
+			report.Files = append(report.Files, fileReport)
+			for _, c := range Categories {
+				if slices.ContainsFunc(fileReport.Findings, func(f Finding) bool { return f.Category == c.ID }) {
+					report.Counts[c.ID]++
+				}
+			}
+		}
+	}
+	return report
+}
+
+// fileReportFor returns the findings in file, whose metadata must have been read with args.
+func fileReportFor(file string, m exif.Metadata) FileReport {
+	r := FileReport{File: file, Findings: []Finding{}}
+	add := func(category, format string, a ...interface{}) {
+		r.Findings = append(r.Findings, Finding{Category: category, Detail: fmt.Sprintf(format, a...)})
+	}
+	addTags := func(category string, tags []string) {
+		for _, tag := range tags {
+			if values := m.Strings(tag); len(values) != 0 {
+				add(category, "%s: %s", tag, strings.Join(values, ", "))
+			}
+		}
+	}
+
+	if loc, ok := rmloc.LocationFromMetadata(m); ok {
+		add("gps", "%.6f, %.6f", loc.Latitude, loc.Longitude)
+	} else {
+		var gpsTags []string
+		for key := range m {
+			if strings.HasPrefix(key, "GPS") && key != "GPSVersionID" {
+				gpsTags = append(gpsTags, key)
+			}
+		}
+		if len(gpsTags) != 0 {
+			sort.Strings(gpsTags)
+			add("gps", "GPS tags: %s", strings.Join(gpsTags, ", "))
+		}
+	}
+
+	addTags("serial_numbers", anonymize.SerialNumberTags)
+	addTags("owner_names", anonymize.OwnerTags)
+
+	faces := 0
+	for _, regionType := range m.Strings("RegionType") {
+		if regionType == "Face" {
+			faces++
+		}
+	}
+	names := slices.Concat(m.Strings("RegionName"), m.Strings("RegionPersonDisplayName"))
+	if faces != 0 || len(names) != 0 {
+		detail := fmt.Sprintf("%d face region(s)", max(faces, len(names)))
+		if len(names) != 0 {
+			detail += ", named " + strings.Join(names, ", ")
+		}
+		add("face_regions", "%s", detail)
+	}
+
+	if thumbnail, ok := m.String("ThumbnailImage"); ok && isJPEG(file) {
+		if stale, reason, err := thumbnailDiffers(file, thumbnail); err != nil {
+			add("stale_thumbnails", "couldn't compare the thumbnail to the image: %s", err)
+		} else if stale {
+			add("stale_thumbnails", "%s", reason)
+		}
+	}
+
+	addTags("software", anonymize.SoftwareTags)
+	if agents := slices.Compact(m.Strings(historySoftwareTag)); len(agents) != 0 {
+		add("software", "editing history: %s", strings.Join(agents, ", "))
+	}
+
+	if state, err := camswap.StateFromMetadata(m); err == nil && state.Swapped() {
+		for _, tag := range camswap.IdentityTags {
+			if original, ok := state.Originals[tag.Name]; ok {
+				swapped, ok := state.Current[tag.Name]
+				if !ok {
+					swapped = "(none)"
+				}
+				add("camswap_originals", "original %s %s (swapped to %s)", tag.Label, original, swapped)
+			}
+		}
+	}
+
+	return r
+}
+
+func isJPEG(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	return ext == ".jpg" || ext == ".jpeg"
+}
@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// Formats lists the report formats Write supports.
+var Formats = []string{"html", "json"}
+
+// Write writes r to w in the given format, one of Formats.
+func Write(w io.Writer, format string, r Report) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "html":
+		return htmlTemplate.Execute(w, r)
+	}
+	return fmt.Errorf("unsupported report format '%s' (supported: %s)", format, strings.Join(Formats, ", "))
+}
+
+var htmlTemplate = template.Must(template.New("audit").Funcs(template.FuncMap{
+	"categories": func() []Category { return Categories },
+	"findingsIn": func(f FileReport, category string) []Finding {
+		var findings []Finding
+		for _, finding := range f.Findings {
+			if finding.Category == category {
+				findings = append(findings, finding)
+			}
+		}
+		return findings
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>xtool privacy audit</title>
+<style>
+  body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+  table { border-collapse: collapse; margin-bottom: 1.5em; }
+  th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+  th { background: #f3f3f3; }
+  td.count { text-align: right; }
+  .none { color: #2a7a2a; }
+  .found { color: #b02020; font-weight: bold; }
+  .description { color: #555; }
+  code { font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>xtool privacy audit</h1>
+<p>Generated {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}} for {{range $i, $root := .Roots}}{{if $i}}, {{end}}<code>{{$root}}</code>{{end}}.
+{{.FilesScanned}} files scanned.</p>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Category</th><th>Files</th></tr>
+{{range categories}}<tr><td><a href="#{{.ID}}">{{.Label}}</a></td><td class="count {{if index $.Counts .ID}}found{{else}}none{{end}}">{{index $.Counts .ID}}</td></tr>
+{{end}}<tr><td><a href="#errors">Unreadable files</a></td><td class="count {{if .Errors}}found{{else}}none{{end}}">{{.Errors}}</td></tr>
+</table>
+{{range categories}}
+<h2 id="{{.ID}}">{{.Label}}</h2>
+<p class="description">{{.Description}}</p>
+{{$category := .ID}}{{with $.FilesIn .ID}}<table>
+<tr><th>File</th><th>Found</th></tr>
+{{range .}}<tr><td><code>{{.File}}</code></td><td>{{range findingsIn . $category}}{{.Detail}}<br>{{end}}</td></tr>
+{{end}}</table>{{else}}<p class="none">✔ None found.</p>{{end}}
+{{end}}
+<h2 id="errors">Unreadable files</h2>
+{{if .Errors}}<table>
+<tr><th>File</th><th>Error</th></tr>
+{{range .Files}}{{if .Error}}<tr><td><code>{{.File}}</code></td><td>{{.Error}}</td></tr>
+{{end}}{{end}}</table>{{else}}<p class="none">✔ None.</p>{{end}}
+</body>
+</html>
+`))
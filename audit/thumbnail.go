@@ -0,0 +1,145 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"os"
+	"strings"
+)
+
+// Thresholds for thumbnailDiffers. Thumbnails are small and heavily compressed, so some
+// difference from the downscaled image is expected even when they show the same thing.
+const (
+	maxAspectDifference   = 0.05 // relative difference between the thumbnail's and image's aspect ratios
+	maxMeanLumaDifference = 12   // mean luma difference, out of 255, per thumbnail pixel
+	changedLumaDifference = 64   // luma difference, out of 255, at which a thumbnail pixel counts as changed
+	maxChangedFraction    = 0.02 // fraction of thumbnail pixels that may be changed
+	letterboxLuma         = 16   // max mean luma of a row or column of the black bars some cameras pad thumbnails with
+)
+
+// thumbnailDiffers reports whether the embedded thumbnail, base64-encoded as exiftool's -j -b
+// output reports it, shows something different from the JPEG image file: a different crop, or
+// edited content. It's a heuristic; reason describes the difference.
+func thumbnailDiffers(file string, thumbnailBase64 string) (bool, string, error) {
+	thumbnailData, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(thumbnailBase64, "base64:"))
+	if err != nil {
+		return false, "", fmt.Errorf("failed to decode thumbnail: %w", err)
+	}
+	thumbnail, err := jpeg.Decode(bytes.NewReader(thumbnailData))
+	if err != nil {
+		return false, "", fmt.Errorf("failed to decode thumbnail: %w", err)
+	}
+	content := trimLetterbox(thumbnail)
+	if content.Empty() {
+		return false, "", errors.New("thumbnail is blank")
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return false, "", err
+	}
+	defer func() { _ = f.Close() }()
+	img, err := jpeg.Decode(f)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	imgAspect := aspect(img.Bounds())
+	if math.Abs(aspect(content)-imgAspect)/imgAspect > maxAspectDifference {
+		return true, fmt.Sprintf("thumbnail is %dx%d, but the image is %dx%d; it may show a different crop",
+			content.Dx(), content.Dy(), img.Bounds().Dx(), img.Bounds().Dy()), nil
+	}
+
+	scaled := downscaleLuma(img, content.Dx(), content.Dy())
+	var total float64
+	changed := 0
+	for y := 0; y < content.Dy(); y++ {
+		for x := 0; x < content.Dx(); x++ {
+			diff := math.Abs(luma(thumbnail, content.Min.X+x, content.Min.Y+y) - scaled[y*content.Dx()+x])
+			total += diff
+			if diff > changedLumaDifference {
+				changed++
+			}
+		}
+	}
+	pixels := float64(content.Dx() * content.Dy())
+	if mean, changedFraction := total/pixels, float64(changed)/pixels; mean > maxMeanLumaDifference || changedFraction > maxChangedFraction {
+		return true, fmt.Sprintf("thumbnail content differs from the image (%.0f%% of thumbnail pixels changed); it may show edited-out content", changedFraction*100), nil
+	}
+	return false, "", nil
+}
+
+func aspect(r image.Rectangle) float64 {
+	return float64(r.Dx()) / float64(r.Dy())
+}
+
+// trimLetterbox returns the bounds of img without any black bars along its edges.
+func trimLetterbox(img image.Image) image.Rectangle {
+	r := img.Bounds()
+	rowLuma := func(y int) float64 {
+		var sum float64
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sum += luma(img, x, y)
+		}
+		return sum / float64(r.Dx())
+	}
+	colLuma := func(x int) float64 {
+		var sum float64
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			sum += luma(img, x, y)
+		}
+		return sum / float64(r.Dy())
+	}
+	for r.Min.Y < r.Max.Y && rowLuma(r.Min.Y) <= letterboxLuma {
+		r.Min.Y++
+	}
+	for r.Max.Y > r.Min.Y && rowLuma(r.Max.Y-1) <= letterboxLuma {
+		r.Max.Y--
+	}
+	for r.Min.X < r.Max.X && colLuma(r.Min.X) <= letterboxLuma {
+		r.Min.X++
+	}
+	for r.Max.X > r.Min.X && colLuma(r.Max.X-1) <= letterboxLuma {
+		r.Max.X--
+	}
+	return r
+}
+
+// downscaleLuma returns img's luma, box-filtered down to w x h, in row-major order.
+func downscaleLuma(img image.Image, w, h int) []float64 {
+	b := img.Bounds()
+	sums := make([]float64, w*h)
+	counts := make([]int, w*h)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := (y - b.Min.Y) * h / b.Dy() * w
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := row + (x-b.Min.X)*w/b.Dx()
+			sums[i] += luma(img, x, y)
+			counts[i]++
+		}
+	}
+	for i := range sums {
+		if counts[i] != 0 {
+			sums[i] /= float64(counts[i])
+		}
+	}
+	return sums
+}
+
+// luma returns the luma of img's pixel at (x, y), out of 255. Decoded JPEGs are YCbCr or gray,
+// whose luma is read directly; full-size images are too large to convert pixel by pixel.
+func luma(img image.Image, x, y int) float64 {
+	switch img := img.(type) {
+	case *image.YCbCr:
+		return float64(img.Y[img.YOffset(x, y)])
+	case *image.Gray:
+		return float64(img.Pix[img.PixOffset(x, y)])
+	}
+	return float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+}
@@ -0,0 +1,305 @@
+// Package backup finds and applies xtool's backups configuration, which controls where
+// exiftool's backups of original files are kept.
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	Location string `json:"backups_location"`         // same_dir, sub_dir, abs_path. same_dir = exiftool default; sub_dir = move exiftool backup files to a subdirectory; abs_path = move backups to a structure under an absolute path
+	Folder   string `json:"backups_folder,omitempty"` // same_dir = no effect; sub_dir = backups at ./backups_folder_TS; abs_path = backups at abs_path/TS source_folder_name, or abs_path/TS source_folder_name (N) if another folder has the same name
+}
+
+const (
+	ConfigFileName = ".xtoolbak.json"
+
+	LocSameDir = "same_dir"
+	LocSubDir  = "sub_dir"
+	LocAbsPath = "abs_path"
+
+	// folderTimestampLayout formats the time in backups folder names.
+	folderTimestampLayout = "2006-01-02T15-04-05"
+
+	// sourceFileName names the file in each abs_path backups folder recording the absolute path
+	// of the directory its backups came from; the folder's name includes only that directory's
+	// base name, which many directories (eg. DCIM) share.
+	sourceFileName = ".xtoolbak_source"
+)
+
+var (
+	configCacheMu sync.Mutex
+	configCache   = make(map[string]Config)
+)
+
+// ConfigFor returns the backups config applicable to the given image file.
+func ConfigFor(filename string) (Config, error) {
+	// Finding the applicable .xtoolbak config file, we search upward starting at the directory the image file is in:
+	// - If under `~`: search stops at ~.
+	// - If under /Volumes, /mnt, /media: search stops at the volume root.
+	// - Else: search stops at root.
+	// If no backup config file is found, a default configuration is returned.
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to find home directory: %w", err)
+	}
+	homeDir = filepath.Clean(homeDir)
+	absImageFilePath, err := filepath.Abs(filename)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to find absolute path for '%s': %w", filename, err)
+	}
+	bakConfigSearchDir := filepath.Dir(absImageFilePath)
+	bakConfigSearchVolName := filepath.VolumeName(bakConfigSearchDir)
+
+	configCacheMu.Lock()
+	cachedConfig, ok := configCache[bakConfigSearchDir]
+	configCacheMu.Unlock()
+	if ok {
+		return cachedConfig, nil
+	}
+
+	i := 0
+	for {
+		if i > 128 {
+			return Config{}, fmt.Errorf("failed to find a backups config for '%s' in 128 iterations", filename)
+		}
+
+		if bakConfigSearchDir == homeDir || bakConfigSearchDir == bakConfigSearchVolName ||
+			bakConfigSearchDir == "/" || filepath.Dir(bakConfigSearchDir) == "/Volumes" ||
+			filepath.Dir(bakConfigSearchDir) == "/mnt" || filepath.Dir(bakConfigSearchDir) == "/media" ||
+			filepath.Dir(bakConfigSearchDir) == "/usb" {
+			break
+		}
+
+		configCandidatePath := filepath.Join(bakConfigSearchDir, ConfigFileName)
+		_, err := os.Stat(configCandidatePath)
+		if err == nil {
+			break
+		}
+
+		bakConfigSearchDir = filepath.Dir(bakConfigSearchDir)
+		i++
+	}
+
+	// Read and parse the relevant .xtoolbak file (or set a default config if none is found):
+
+	backupsConfig := Config{}
+	backupsConfigPath := filepath.Join(bakConfigSearchDir, ConfigFileName)
+	backupsConfigBytes, err := os.ReadFile(backupsConfigPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			backupsConfig.Location = LocSameDir
+		} else {
+			return backupsConfig, fmt.Errorf("failed to read '%s': %w", backupsConfigPath, err)
+		}
+	} else {
+		err = json.Unmarshal(backupsConfigBytes, &backupsConfig)
+		if err != nil {
+			return backupsConfig, fmt.Errorf("failed to parse '%s' as JSON: %w", backupsConfigPath, err)
+		}
+	}
+
+	// Validate backups config:
+
+	if backupsConfig.Location != LocSameDir && backupsConfig.Location != LocSubDir && backupsConfig.Location != LocAbsPath {
+		return backupsConfig, fmt.Errorf("backups_location must be one of (same_dir, sub_dir, abs_path); got '%s'", backupsConfig.Location)
+	}
+
+	if backupsConfig.Location == LocSubDir && backupsConfig.Folder == "" {
+		return backupsConfig, errors.New("'backups_location: sub_dir' requires setting a backups_folder, to name the backups subdirectory")
+	}
+
+	if backupsConfig.Location == LocSubDir && strings.Contains(backupsConfig.Folder, string(os.PathSeparator)) {
+		return backupsConfig, errors.New("backups_folder must be a simple directory name for 'backups_location: sub_dir'")
+	}
+
+	if backupsConfig.Location == LocAbsPath {
+		if backupsConfig.Folder == "" {
+			return backupsConfig, errors.New("'backups_location: abs_path' requires setting backups_folder to an absolute path")
+		}
+		if stat, err := os.Stat(backupsConfig.Folder); err != nil {
+			return backupsConfig, fmt.Errorf("bad backups_folder '%s': %s", backupsConfig.Folder, err)
+		} else if !stat.IsDir() {
+			return backupsConfig, fmt.Errorf("bad backups_folder '%s': is not a directory", backupsConfig.Folder)
+		}
+	}
+
+	configCacheMu.Lock()
+	configCache[filepath.Dir(absImageFilePath)] = backupsConfig
+	configCacheMu.Unlock()
+	return backupsConfig, nil
+}
+
+// PrepareDir creates the backups folder for the given image file and returns its path.
+// It returns an empty path if backups should stay next to the original file.
+func (c Config) PrepareDir(filename string, startTime time.Time) (string, error) {
+	backupsPath := ""
+	ts := startTime.Format(folderTimestampLayout)
+	absFilePath, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	var parentMode os.FileMode
+	switch c.Location {
+	case LocSubDir:
+		backupsPath = filepath.Join(
+			filepath.Dir(absFilePath),
+			fmt.Sprintf("%s_%s", c.Folder, ts),
+		)
+		stat, err := os.Stat(filepath.Dir(absFilePath))
+		if err != nil {
+			return "", err
+		}
+		parentMode = stat.Mode() & os.ModePerm
+	case LocAbsPath:
+		stat, err := os.Stat(c.Folder)
+		if err != nil {
+			return "", err
+		}
+		return prepareAbsPathDir(c.Folder, ts, filepath.Dir(absFilePath), stat.Mode()&os.ModePerm)
+	}
+	if backupsPath != "" {
+		err := os.MkdirAll(backupsPath, parentMode)
+		if err != nil {
+			return "", fmt.Errorf("failed to create backups directory '%s': %w", backupsPath, err)
+		}
+	}
+	return backupsPath, nil
+}
+
+// prepareAbsPathDir creates, or finds, the abs_path backups folder in root for files from
+// sourceDir, named "TS source_folder_name", or "TS source_folder_name (2)", etc. if a folder by
+// that name holds backups from another directory with the same name.
+func prepareAbsPathDir(root, ts, sourceDir string, mode os.FileMode) (string, error) {
+	name := fmt.Sprintf("%s %s", ts, filepath.Base(sourceDir))
+	for i := 1; ; i++ {
+		backupsPath := filepath.Join(root, name)
+		if i > 1 {
+			backupsPath = filepath.Join(root, fmt.Sprintf("%s (%d)", name, i))
+		}
+		err := os.Mkdir(backupsPath, mode)
+		if err == nil {
+			sourceFile := filepath.Join(backupsPath, sourceFileName)
+			if err := os.WriteFile(sourceFile, []byte(sourceDir+"\n"), 0o644); err != nil {
+				return "", fmt.Errorf("failed to write '%s': %w", sourceFile, err)
+			}
+			return backupsPath, nil
+		}
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("failed to create backups directory '%s': %w", backupsPath, err)
+		}
+		if backupsSource(backupsPath) == sourceDir {
+			return backupsPath, nil
+		}
+	}
+}
+
+// backupsSource returns the source directory recorded in an abs_path backups folder, or "" if
+// none is recorded.
+func backupsSource(backupsPath string) string {
+	source, err := os.ReadFile(filepath.Join(backupsPath, sourceFileName))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(source))
+}
+
+// Store moves backupFile, a backup of the given image file, into the image file's backups folder.
+// It returns the backup's new path, which is unchanged for same_dir backups.
+func Store(filename, backupFile string, startTime time.Time) (string, error) {
+	backupsConfig, err := ConfigFor(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to get backups config: %w", err)
+	}
+	backupsPath, err := backupsConfig.PrepareDir(filename, startTime)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare backups folder: %w", err)
+	}
+	if backupsPath == "" {
+		return backupFile, nil
+	}
+	newBackupFilePath := filepath.Join(backupsPath, filepath.Base(filename))
+	err = os.Rename(backupFile, newBackupFilePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to move backup file '%s' to the backups folder: %w", backupFile, err)
+	}
+	return newBackupFilePath, nil
+}
+
+// ErrNoBackup is returned by Newest if the file has no backup.
+var ErrNoBackup = errors.New("no backup found")
+
+// Newest returns the path of the most recent backup of the given image file, in the backups
+// folder configured for it (see ConfigFor). It returns ErrNoBackup if there is none.
+// For same_dir backups, exiftool keeps only its first backup, never overwriting it, so this is
+// the file as it was before it was first modified. abs_path backups folders made before xtool
+// recorded their source directory are ignored, as they can't be told apart from backups of
+// other directories with the same name.
+func Newest(filename string) (string, error) {
+	backupsConfig, err := ConfigFor(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to get backups config: %w", err)
+	}
+	absFilePath, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+
+	// backups folders are named with the start time of the batch that made them (see PrepareDir),
+	// so the newest folder sorts last:
+	var searchDir string
+	var isBackupsFolder func(name string) bool
+	switch backupsConfig.Location {
+	case LocSameDir:
+		// exiftool's own backup, which it doesn't overwrite once it exists:
+		backupFile := absFilePath + "_original"
+		if _, err := os.Stat(backupFile); err != nil {
+			if os.IsNotExist(err) {
+				return "", ErrNoBackup
+			}
+			return "", err
+		}
+		return backupFile, nil
+	case LocSubDir:
+		searchDir = filepath.Dir(absFilePath)
+		isBackupsFolder = func(name string) bool {
+			ts, ok := strings.CutPrefix(name, backupsConfig.Folder+"_")
+			return ok && isTimestamp(ts)
+		}
+	case LocAbsPath:
+		searchDir = backupsConfig.Folder
+		sourceDir := filepath.Dir(absFilePath)
+		isBackupsFolder = func(name string) bool {
+			ts, _, ok := strings.Cut(name, " ")
+			return ok && isTimestamp(ts) && backupsSource(filepath.Join(searchDir, name)) == sourceDir
+		}
+	}
+
+	entries, err := os.ReadDir(searchDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backups folder: %w", err)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].IsDir() || !isBackupsFolder(entries[i].Name()) {
+			continue
+		}
+		backupFile := filepath.Join(searchDir, entries[i].Name(), filepath.Base(absFilePath))
+		if _, err := os.Stat(backupFile); err == nil {
+			return backupFile, nil
+		}
+	}
+	return "", ErrNoBackup
+}
+
+func isTimestamp(s string) bool {
+	_, err := time.Parse(folderTimestampLayout, s)
+	return err == nil
+}
@@ -4,42 +4,78 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"os"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/google/subcommands"
+
+	"xtool/camswap"
+	"xtool/exif"
 )
 
 type camswapCmd struct {
-	restore     bool
-	suffix      bool
-	outDir      string
-	verbose     bool
-	verbose2    bool
-	newCamModel string
-	appConfig   AppConfig
+	restore              bool
+	restoreAll           bool
+	auto                 bool
+	list                 bool
+	suffix               bool
+	outDir               string
+	verify               bool
+	verbose              bool
+	verbose2             bool
+	newCamModel          string
+	newMake              string
+	newLensMake          string
+	newLensModel         string
+	newSerialNumber      string
+	newInternalSerialNum string
+	appConfig            AppConfig
 }
 
 func (*camswapCmd) Name() string     { return "camswap" }
 func (*camswapCmd) Synopsis() string { return "Swap in a different camera name." }
 
 func (*camswapCmd) Usage() string {
-	return `camswap [-c CAM_MODEL|-c CAM_ALIAS] [-r] [-s] [-d out_dir] [-v|-vv] file1.jpg [file2.nef ...]:
-  Swaps a different camera model into the given photos' EXIF data.
-  Persists the original name in an XMP attribute for restoration with the -r flag.
-  Exactly one of (-c, -r) is required.
+	return `camswap -list | [-c CAM_MODEL|-c CAM_ALIAS|-auto] [-make MAKE] [-lens-make MAKE] [-lens LENS_MODEL] [-serial SERIAL] [-internal-serial SERIAL] [-r [-all]] [-s] [-d out_dir] [-verify] [-v|-vv] file1.jpg [file2.nef ...]:
+  Swaps a different camera identity into the given photos' EXIF and XMP data: the camera model,
+  and optionally its make, lens make & model, and serial numbers. An alias defined in camswap_aliases
+  may set all of these; values given via flags override the alias's.
+  Identity tags listed in camswap_tags (by default, Make and Model) are always swapped, and are
+  removed if no new value is given; so set the new camera's make with -make or in its alias. The
+  XMP-aux:Lens tag is kept in sync with the lens model whenever the lens model is swapped.
+  Persists the original values in XMP attributes for restoration with the -r flag.
+  An already-swapped photo may be swapped again; -r undoes the most recent swap, and -r -all restores
+  the original identity.
+  With -auto, each photo is swapped to the alias named by the first camswap_rules entry matching its
+  camera; photos no rule matches, and photos that have already been swapped, are skipped, so -auto
+  can safely be run again over the same photos.
+  With -verify, each modified file is re-read to check the new identity (or the restored one) was
+  written and the original camera model is stashed; a file that fails this check is restored from
+  its backup and reported as an error.
+  Exactly one of (-c, -auto, -r) is required.
 `
 }
 
 func (p *camswapCmd) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&p.suffix, "s", false, "Write modified images to new files named with a suffix derived from the camera name/alias, rather than to the originals.")
 	f.StringVar(&p.outDir, "d", "", "Write modified images to this directory.")
+	f.BoolVar(&p.verify, "verify", false, "Re-read each modified image and check the swap was written correctly; revert it if not.")
 	f.BoolVar(&p.verbose, "v", false, "Print full exiftool output for each image.")
 	f.BoolVar(&p.verbose2, "vv", false, "Print exiftool commands and full exiftool output.")
 
 	f.StringVar(&p.newCamModel, "c", "", "Camera model to swap in (or alias defined in camswap_aliases).")
-	f.BoolVar(&p.restore, "r", false, "Restore the original camera name from xtool's XMP attribute.")
+	f.StringVar(&p.newMake, "make", "", "Camera make to swap in.")
+	f.StringVar(&p.newLensMake, "lens-make", "", "Lens make to swap in.")
+	f.StringVar(&p.newLensModel, "lens", "", "Lens model to swap in.")
+	f.StringVar(&p.newSerialNumber, "serial", "", "Camera serial number to swap in.")
+	f.StringVar(&p.newInternalSerialNum, "internal-serial", "", "Internal camera serial number to swap in.")
+	f.BoolVar(&p.restore, "r", false, "Undo the most recent camera swap, using xtool's XMP attributes.")
+	f.BoolVar(&p.restoreAll, "all", false, "With -r, undo every camera swap, restoring the original camera identity.")
+	f.BoolVar(&p.auto, "auto", false, "Swap each image to the alias chosen by the first matching rule in camswap_rules.")
+	f.BoolVar(&p.list, "list", false, "List the aliases defined in camswap_aliases, and what each one sets.")
 }
 
 func (p *camswapCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
@@ -47,86 +83,86 @@ func (p *camswapCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interfac
 		p.verbose = true
 	}
 
-	if len(f.Args()) == 0 || (!p.restore && p.newCamModel == "") || (p.restore && p.newCamModel != "") {
+	if p.list {
+		p.appConfig = AppConfigFromCtx(ctx)
+		p.printAliases()
+		return subcommands.ExitSuccess
+	}
+
+	newIdentityGiven := p.newCamModel != ""
+	for _, value := range p.flagIdentity() {
+		newIdentityGiven = newIdentityGiven || value != ""
+	}
+	modes := 0
+	for _, mode := range []bool{p.newCamModel != "", p.auto, p.restore} {
+		if mode {
+			modes++
+		}
+	}
+	if len(f.Args()) == 0 || modes != 1 || (p.restore && newIdentityGiven) || (p.restoreAll && !p.restore) {
 		f.Usage()
 		return subcommands.ExitUsageError
 	}
 
 	p.appConfig = AppConfigFromCtx(ctx)
 
-	exiftoolConfigFilename, err := getExiftoolConfigFileName()
+	et, err := newExiftool(p.appConfig, p.verbose2)
 	if err != nil {
 		ErrPrint(ctx, err)
 		return subcommands.ExitFailure
 	}
 	//goland:noinspection GoUnhandledErrorResult
-	defer func() { _ = os.Remove(exiftoolConfigFilename) }()
+	defer func() { _ = et.Close() }()
 
-	var exiftoolArgs []string
+	opts := camswap.Options{Output: exif.Output{Dir: p.outDir, Suffix: p.suffix}, Verify: p.verify}
+	var process func(string, time.Time) exif.Result
 	if p.restore {
-		exiftoolArgs = []string{
-			"-config", exiftoolConfigFilename,
-			"-Model<XtoolOriginalCameraModel",
-			"-XtoolOriginalCameraModel=",
-			"-if", "$XtoolOriginalCameraModel",
+		process = func(imgFilename string, startTime time.Time) exif.Result {
+			return camswap.Restore(ctx, et, imgFilename, p.restoreAll, opts, startTime)
 		}
-
-		if p.outDir != "" && p.suffix {
-			exiftoolArgs = append(exiftoolArgs, "-o", fmt.Sprintf("%s%s%%f_unswap.%%e", p.outDir, string(os.PathSeparator)))
-		} else if p.suffix {
-			exiftoolArgs = append(exiftoolArgs, "-o", "%d%f_unswap.%e")
-		} else if p.outDir != "" {
-			exiftoolArgs = append(exiftoolArgs, "-o", fmt.Sprintf("%s%s", p.outDir, string(os.PathSeparator)))
+	} else if p.auto {
+		if len(p.appConfig.CamswapRules) == 0 {
+			ErrPrintln(ctx, "camswap -auto requires rules defined in camswap_rules")
+			return subcommands.ExitFailure
 		}
-	} else {
-		newModel := p.newCamModel
-		if p.appConfig.CamswapAliases[p.newCamModel] != "" {
-			newModel = p.appConfig.CamswapAliases[p.newCamModel]
-		}
-
-		exiftoolArgs = []string{
-			"-config", exiftoolConfigFilename,
-			"-XtoolOriginalCameraModel<Model",
-			fmt.Sprintf("-Model=%s", newModel),
-			"-if", "not $XtoolOriginalCameraModel",
+		process = func(imgFilename string, startTime time.Time) exif.Result {
+			state, err := camswap.ReadState(ctx, et, imgFilename)
+			if err != nil {
+				return exif.Result{File: imgFilename, Err: err}
+			}
+			if state.Swapped() {
+				// rules match the camera that made the photo, which a swapped photo no longer names:
+				return exif.Result{File: imgFilename, SkipReason: "already swapped; use -r to undo the swap, or -c to swap it again"}
+			}
+			rule, ok := camswap.MatchRule(p.appConfig.CamswapRules, state.Current)
+			if !ok {
+				return exif.Result{File: imgFilename, SkipReason: fmt.Sprintf("no camswap rule matches %s", valueOrNone(state.Current, "Model"))}
+			}
+			fmt.Printf("matched %s; swapping to %s\n", color.MagentaString(rule.Name), color.MagentaString(rule.Alias))
+			identity, tags, suffixName := p.swapTarget(rule.Alias)
+			return camswap.SwapFrom(ctx, et, imgFilename, state, identity, tags, suffixName, opts, startTime)
 		}
-
-		suffixSafeCamModel := strings.ReplaceAll(p.newCamModel, " ", "-")
-		if p.outDir != "" && p.suffix {
-			exiftoolArgs = append(exiftoolArgs, "-o", fmt.Sprintf("%s%s%%d%%f_%s.%%e", p.outDir, string(os.PathSeparator), suffixSafeCamModel))
-		} else if p.suffix {
-			exiftoolArgs = append(exiftoolArgs, "-o", fmt.Sprintf("%%d%%f_%s.%%e", suffixSafeCamModel))
-		} else if p.outDir != "" {
-			exiftoolArgs = append(exiftoolArgs, "-o", fmt.Sprintf("%s%s", p.outDir, string(os.PathSeparator)))
+	} else {
+		identity, tags, suffixName := p.swapTarget(p.newCamModel)
+		process = func(imgFilename string, startTime time.Time) exif.Result {
+			return camswap.Swap(ctx, et, imgFilename, identity, tags, suffixName, opts, startTime)
 		}
 	}
 
-	successes, failures := ExiftoolProcess(
-		ctx,
-		exiftoolArgs,
-		f.Args(),
-		p.appConfig,
-		p.verbose,
-		p.verbose2,
-	)
+	successes, failures := ExiftoolProcess(ctx, f.Args(), p.verbose, p.verbose2, process)
 
 	boldWhitePrintf := color.New(color.Bold, color.FgWhite).PrintfFunc()
 	boldRedPrintf := color.New(color.Bold, color.FgRed).PrintfFunc()
 
 	boldWhitePrintf("\ncamswap: successfully processed %d images.\n", len(successes))
+	if skipped := len(f.Args()) - len(successes) - len(failures); skipped > 0 {
+		boldWhitePrintf("camswap: skipped %d images.\n", skipped)
+	}
 
 	if len(failures) != 0 {
 		boldRedPrintf("Errors:\n")
 		for filename, err := range failures {
-			errString := err.Error()
-			if strings.Contains(err.Error(), "failed condition") {
-				if p.restore {
-					errString = "no camera swap metadata attached"
-				} else {
-					errString = "has already been camswapped"
-				}
-			}
-			fmt.Printf("- %s %s\n", color.MagentaString("%s:", filename), errString)
+			fmt.Printf("- %s %s\n", color.MagentaString("%s:", filename), err)
 		}
 		return subcommands.ExitFailure
 	}
@@ -134,27 +170,76 @@ func (p *camswapCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interfac
 	return subcommands.ExitSuccess
 }
 
-func getExiftoolConfigFileName() (string, error) {
-	exiftoolConfigFile, err := os.CreateTemp("", "xtool_xmp")
-	if err != nil {
-		return "", fmt.Errorf("failed to create exiftool XMP config file: %w", err)
+// swapTarget returns the identity to swap in for the given camera model or alias, overridden by
+// any identity values given via flags; the identity tags the swap covers; and the suffix naming -s output files.
+func (p *camswapCmd) swapTarget(modelOrAlias string) (camswap.Identity, []string, string) {
+	profile, ok := p.appConfig.CamswapAliases[modelOrAlias]
+	if !ok {
+		profile = camswap.Profile{Model: modelOrAlias}
 	}
-	exiftoolConfigFilename := exiftoolConfigFile.Name()
-	if _, err = exiftoolConfigFile.Write([]byte(exiftoolXtoolXmpConfig)); err != nil {
-		return "", fmt.Errorf("failed to write exiftool XMP config file: %w", err)
+	identity := profile.Identity()
+	for tag, value := range p.flagIdentity() {
+		if value != "" {
+			identity[tag] = value
+		}
 	}
-	if err = exiftoolConfigFile.Close(); err != nil {
-		return "", fmt.Errorf("failed to close exiftool XMP config file: %w", err)
+	return identity, camswap.ManagedTags(p.appConfig.CamswapTags, identity), camswapSuffixName(p.appConfig, modelOrAlias)
+}
+
+// camswapSuffixName returns the name -s output files are named with when swapping to the given
+// camera model or alias: the alias's suffix, if it sets one, or else the model or alias itself.
+func camswapSuffixName(appConfig AppConfig, modelOrAlias string) string {
+	if profile, ok := appConfig.CamswapAliases[modelOrAlias]; ok && profile.Suffix != "" {
+		return profile.Suffix
 	}
-	return exiftoolConfigFilename, nil
+	return modelOrAlias
 }
 
-const exiftoolXtoolXmpConfig = `
-%Image::ExifTool::UserDefined = (
-    'Image::ExifTool::XMP::xmp' => {
-        XtoolOriginalCameraModel => { },
-    },
-);
+// flagIdentity returns the identity tag values given via flags other than -c.
+func (p *camswapCmd) flagIdentity() camswap.Identity {
+	return camswap.Identity{
+		"Make":                 p.newMake,
+		"LensMake":             p.newLensMake,
+		"LensModel":            p.newLensModel,
+		"SerialNumber":         p.newSerialNumber,
+		"InternalSerialNumber": p.newInternalSerialNum,
+	}
+}
 
-1;
-`
+func (p *camswapCmd) printAliases() {
+	boldWhitePrintf := color.New(color.Bold, color.FgWhite).PrintfFunc()
+
+	if len(p.appConfig.CamswapAliases) == 0 {
+		fmt.Println("No aliases are defined in camswap_aliases.")
+		return
+	}
+
+	aliases := make([]string, 0, len(p.appConfig.CamswapAliases))
+	for alias := range p.appConfig.CamswapAliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		profile := p.appConfig.CamswapAliases[alias]
+		identity := profile.Identity()
+		managedTags := camswap.ManagedTags(p.appConfig.CamswapTags, identity)
+
+		boldWhitePrintf("%s\n", alias)
+		for _, tag := range camswap.IdentityTags {
+			if !slices.Contains(managedTags, tag.Name) {
+				continue
+			}
+			value := identity[tag.Name]
+			if value == "" {
+				value = "(removed)"
+			}
+			fmt.Printf("\t%s %s\n", color.MagentaString("%s:", tag.Label), value)
+		}
+		suffix := profile.Suffix
+		if suffix == "" {
+			suffix = alias
+		}
+		fmt.Printf("\t%s %s\n", color.MagentaString("-s Suffix:"), strings.ReplaceAll(suffix, " ", "-"))
+	}
+}
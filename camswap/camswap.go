@@ -0,0 +1,327 @@
+// Package camswap swaps a different camera identity (make, model, lens, and serial numbers) into
+// images' metadata. The original values are stashed in xtool XMP tags, so they can be restored later.
+//
+// A file may be camswapped repeatedly. Each swap is recorded in the file's swap history, and
+// Restore can undo either the most recent swap or every swap.
+package camswap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"xtool/exif"
+)
+
+var ErrNotSwapped = errors.New("no camera swap metadata attached")
+
+// IdentityTag is a tag identifying the camera or lens an image was made with.
+type IdentityTag struct {
+	Name     string   // exiftool tag name; writing it updates every group (EXIF, XMP, maker notes) the tag exists in
+	Label    string   // human-readable name
+	StashTag string   // xtool XMP tag the original value is stashed in
+	Mirrors  []string // XMP tags carrying the same value under a different name, kept in sync with Name
+	Private  bool     // the original value identifies the photographer's equipment, so it's kept only in StashTag, never in the swap history
+}
+
+// IdentityTags lists every tag camswap can swap.
+var IdentityTags = []IdentityTag{
+	{Name: "Make", Label: "Camera Make", StashTag: exif.TagOriginalMake},
+	{Name: "Model", Label: "Camera Model", StashTag: exif.TagOriginalCameraModel},
+	{Name: "LensMake", Label: "Lens Make", StashTag: exif.TagOriginalLensMake},
+	{Name: "LensModel", Label: "Lens Model", StashTag: exif.TagOriginalLensModel, Mirrors: []string{"XMP-aux:Lens"}},
+	{Name: "SerialNumber", Label: "Serial Number", StashTag: exif.TagOriginalSerialNumber, Private: true},
+	{Name: "InternalSerialNumber", Label: "Internal Serial Number", StashTag: exif.TagOriginalInternalSerialNumber, Private: true},
+}
+
+// IsIdentityTag reports whether name is the name of one of IdentityTags.
+func IsIdentityTag(name string) bool {
+	return slices.ContainsFunc(IdentityTags, func(tag IdentityTag) bool { return tag.Name == name })
+}
+
+// Identity maps identity tag names (see IdentityTags) to the values to swap in.
+type Identity map[string]string
+
+// DefaultTags are the identity tags every swap covers when xtool's camswap_tags config doesn't
+// list any, so that a swapped file's make matches its model.
+var DefaultTags = []string{"Make", "Model"}
+
+// ManagedTags returns the identity tags a swap to id should cover: those listed in configured
+// (or DefaultTags, if configured is empty), plus any tag id has a value for. Model is always included.
+func ManagedTags(configured []string, id Identity) []string {
+	if len(configured) == 0 {
+		configured = DefaultTags
+	}
+	var tags []string
+	for _, tag := range IdentityTags {
+		if tag.Name == "Model" || id[tag.Name] != "" || slices.Contains(configured, tag.Name) {
+			tags = append(tags, tag.Name)
+		}
+	}
+	return tags
+}
+
+// HistoryEntry records one camswap applied to a file, and the identity tag values the file
+// had before that swap.
+type HistoryEntry struct {
+	At      string            `json:"at,omitempty"` // RFC 3339; empty for swaps made by earlier versions of xtool
+	Tags    []string          `json:"tags"`
+	Values  map[string]string `json:"values,omitempty"`   // tags without a value before the swap, and the original values of Private tags, are omitted
+	NewTags []string          `json:"new_tags,omitempty"` // tags this swap was the first to change
+}
+
+// PreviousValue returns the value tag had before the swap e records, given the file's stashed
+// originals; tags this swap was the first to change had their original values, which for Private
+// tags are recorded only in the stash. It returns "" if the tag had no value.
+func (e HistoryEntry) PreviousValue(tag string, originals map[string]string) string {
+	if slices.Contains(e.NewTags, tag) {
+		if value, ok := e.Values[tag]; ok {
+			return value
+		}
+		return originals[tag]
+	}
+	return e.Values[tag]
+}
+
+// State is a file's camswap metadata.
+type State struct {
+	Current     map[string]string // current identity tag values
+	Originals   map[string]string // original values of swapped identity tags, as stashed by the first swap
+	SwappedTags []string          // identity tags changed from their original values; empty if the file hasn't been swapped
+	History     []HistoryEntry    // oldest first
+}
+
+func (s State) Swapped() bool {
+	return len(s.SwappedTags) != 0
+}
+
+// StateArgs returns the exiftool arguments that read the tags StateFromMetadata needs.
+func StateArgs() []string {
+	args := []string{"-" + exif.TagSwappedTags, "-" + exif.TagSwapHistory}
+	for _, tag := range IdentityTags {
+		args = append(args, "-"+tag.Name, "-"+tag.StashTag)
+	}
+	return args
+}
+
+// StateFromMetadata returns the camswap state recorded in a file's metadata, which must have
+// been read with StateArgs.
+func StateFromMetadata(m exif.Metadata) (State, error) {
+	state := State{
+		Current:   make(map[string]string),
+		Originals: make(map[string]string),
+	}
+	for _, tag := range IdentityTags {
+		if value, ok := m.String(tag.Name); ok {
+			state.Current[tag.Name] = value
+		}
+		if value, ok := m.String(tag.StashTag); ok {
+			state.Originals[tag.Name] = value
+		}
+	}
+
+	if swapped, ok := m.String(exif.TagSwappedTags); ok && swapped != "" {
+		state.SwappedTags = strings.Split(swapped, ",")
+	} else if _, ok := state.Originals["Model"]; ok {
+		// files swapped by earlier versions of xtool only have their model stashed:
+		state.SwappedTags = []string{"Model"}
+	}
+
+	for _, entryJSON := range m.Strings(exif.TagSwapHistory) {
+		var entry HistoryEntry
+		if err := json.Unmarshal([]byte(entryJSON), &entry); err != nil {
+			return state, fmt.Errorf("failed to parse camswap history entry '%s': %w", entryJSON, err)
+		}
+		state.History = append(state.History, entry)
+	}
+	if len(state.History) == 0 && state.Swapped() {
+		// swapped by an earlier version of xtool, which didn't record history:
+		state.History = []HistoryEntry{{
+			Tags:    state.SwappedTags,
+			Values:  state.Originals,
+			NewTags: state.SwappedTags,
+		}}
+	}
+
+	return state, nil
+}
+
+// ReadState reads file's camswap state.
+func ReadState(ctx context.Context, et *exif.Exiftool, file string) (State, error) {
+	result, err := et.ReadJSON(ctx, StateArgs(), file)
+	if err != nil {
+		return State{}, err
+	}
+	if len(result) != 1 {
+		return State{}, fmt.Errorf("invalid exiftool output: expected 1 item, got %d", len(result))
+	}
+	return StateFromMetadata(result[0])
+}
+
+// SwapArgs returns the exiftool arguments that swap id into a file with the given camswap state.
+// Each of tags is set to its value in id, or removed if id has no value for it. Tags that
+// haven't been swapped before have their original values stashed.
+// suffixName names the output files when out.Suffix is set.
+func SwapArgs(state State, id Identity, tags []string, suffixName string, out exif.Output, at time.Time) ([]string, error) {
+	entry := HistoryEntry{
+		At:     at.Format(time.RFC3339),
+		Tags:   tags,
+		Values: make(map[string]string),
+	}
+	var swappedTags []string
+	var exiftoolArgs []string
+	for _, tag := range IdentityTags {
+		alreadySwapped := slices.Contains(state.SwappedTags, tag.Name)
+		if !slices.Contains(tags, tag.Name) {
+			if alreadySwapped {
+				swappedTags = append(swappedTags, tag.Name)
+			}
+			continue
+		}
+
+		if value, ok := state.Current[tag.Name]; ok && !(tag.Private && !alreadySwapped) {
+			entry.Values[tag.Name] = value
+		}
+		swappedTags = append(swappedTags, tag.Name)
+		if !alreadySwapped {
+			entry.NewTags = append(entry.NewTags, tag.Name)
+			exiftoolArgs = append(exiftoolArgs, "-"+tag.StashTag+"<"+tag.Name)
+		}
+		for _, name := range append([]string{tag.Name}, tag.Mirrors...) {
+			exiftoolArgs = append(exiftoolArgs, fmt.Sprintf("-%s=%s", name, id[tag.Name]))
+		}
+	}
+	exiftoolArgs = append(exiftoolArgs, fmt.Sprintf("-%s=%s", exif.TagSwappedTags, strings.Join(swappedTags, ",")))
+	history, err := historyArgs(append(slices.Clone(state.History), entry))
+	if err != nil {
+		return nil, err
+	}
+	exiftoolArgs = append(exiftoolArgs, history...)
+
+	suffixSafeCamModel := strings.ReplaceAll(suffixName, " ", "-")
+	return append(exiftoolArgs, out.Args(suffixSafeCamModel)...), nil
+}
+
+// RestoreArgs returns the exiftool arguments that undo the most recent swap recorded in state,
+// or every swap if all is set. Undoing the only swap restores the original identity and removes
+// xtool's swap metadata.
+func RestoreArgs(state State, all bool, out exif.Output) ([]string, error) {
+	if !state.Swapped() {
+		return nil, ErrNotSwapped
+	}
+
+	var exiftoolArgs []string
+	if all || len(state.History) <= 1 {
+		for _, tag := range IdentityTags {
+			if !slices.Contains(state.SwappedTags, tag.Name) {
+				continue
+			}
+			// "-TAG= -TAG<SRC" removes TAG when SRC doesn't exist, ie. when the file had no value for TAG before it was swapped:
+			for _, name := range append([]string{tag.Name}, tag.Mirrors...) {
+				exiftoolArgs = append(exiftoolArgs, "-"+name+"=", "-"+name+"<"+tag.StashTag)
+			}
+		}
+		for _, tag := range IdentityTags {
+			exiftoolArgs = append(exiftoolArgs, "-"+tag.StashTag+"=")
+		}
+		exiftoolArgs = append(exiftoolArgs, "-"+exif.TagSwappedTags+"=", "-"+exif.TagSwapHistory+"=")
+	} else {
+		last := state.History[len(state.History)-1]
+		var swappedTags []string
+		for _, tag := range IdentityTags {
+			if slices.Contains(last.NewTags, tag.Name) {
+				exiftoolArgs = append(exiftoolArgs, "-"+tag.StashTag+"=")
+			} else if slices.Contains(state.SwappedTags, tag.Name) {
+				swappedTags = append(swappedTags, tag.Name)
+			}
+			if !slices.Contains(last.Tags, tag.Name) {
+				continue
+			}
+			value := last.PreviousValue(tag.Name, state.Originals) // an empty value removes the tag
+			for _, name := range append([]string{tag.Name}, tag.Mirrors...) {
+				exiftoolArgs = append(exiftoolArgs, fmt.Sprintf("-%s=%s", name, value))
+			}
+		}
+		exiftoolArgs = append(exiftoolArgs, fmt.Sprintf("-%s=%s", exif.TagSwappedTags, strings.Join(swappedTags, ",")))
+		history, err := historyArgs(state.History[:len(state.History)-1])
+		if err != nil {
+			return nil, err
+		}
+		exiftoolArgs = append(exiftoolArgs, history...)
+	}
+
+	return append(exiftoolArgs, out.Args("unswap")...), nil
+}
+
+// historyArgs returns the exiftool arguments that replace a file's swap history.
+func historyArgs(history []HistoryEntry) ([]string, error) {
+	if len(history) == 0 {
+		return []string{"-" + exif.TagSwapHistory + "="}, nil
+	}
+	// assigning a list-type tag multiple times in one command sets the list to all the assigned values:
+	args := make([]string, 0, len(history))
+	for _, entry := range history {
+		entryJSON, err := json.Marshal(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode camswap history entry: %w", err)
+		}
+		args = append(args, fmt.Sprintf("-%s=%s", exif.TagSwapHistory, entryJSON))
+	}
+	return args, nil
+}
+
+// Options control how Swap and Restore write their changes.
+type Options struct {
+	Output exif.Output
+	Verify bool // re-read the modified file and check the change landed; if it didn't, revert it and fail
+}
+
+// Swap swaps id into file's metadata, covering the given identity tags (see SwapArgs). A file
+// that has already been camswapped is swapped again, adding a level to its swap history.
+// See exif.Exiftool.ProcessFile for how backups are handled.
+func Swap(ctx context.Context, et *exif.Exiftool, file string, id Identity, tags []string, suffixName string, opts Options, startTime time.Time) exif.Result {
+	state, err := ReadState(ctx, et, file)
+	if err != nil {
+		return exif.Result{File: file, Err: err}
+	}
+	return SwapFrom(ctx, et, file, state, id, tags, suffixName, opts, startTime)
+}
+
+// SwapFrom is Swap for a file whose camswap state has already been read.
+func SwapFrom(ctx context.Context, et *exif.Exiftool, file string, state State, id Identity, tags []string, suffixName string, opts Options, startTime time.Time) exif.Result {
+	exiftoolArgs, err := SwapArgs(state, id, tags, suffixName, opts.Output, time.Now())
+	if err != nil {
+		return exif.Result{File: file, Err: err}
+	}
+	res := et.ProcessFile(ctx, exiftoolArgs, file, startTime)
+	if opts.Verify {
+		res = exif.Verify(ctx, res, func(ctx context.Context, path string) error {
+			return VerifySwap(ctx, et, path, state, id, tags)
+		})
+	}
+	return res
+}
+
+// Restore undoes the most recent camswap applied to file, or every camswap if all is set.
+// It fails with ErrNotSwapped if the file has not been camswapped.
+func Restore(ctx context.Context, et *exif.Exiftool, file string, all bool, opts Options, startTime time.Time) exif.Result {
+	state, err := ReadState(ctx, et, file)
+	if err != nil {
+		return exif.Result{File: file, Err: err}
+	}
+	exiftoolArgs, err := RestoreArgs(state, all, opts.Output)
+	if err != nil {
+		return exif.Result{File: file, Err: err}
+	}
+	res := et.ProcessFile(ctx, exiftoolArgs, file, startTime)
+	if opts.Verify {
+		res = exif.Verify(ctx, res, func(ctx context.Context, path string) error {
+			return VerifyRestore(ctx, et, path, state, all)
+		})
+	}
+	return res
+}
@@ -0,0 +1,134 @@
+package camswap
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"xtool/exif"
+)
+
+func TestManagedTags(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		configured []string
+		id         Identity
+		want       []string
+	}{
+		{"defaults", nil, Identity{"Model": "SIGMA fp"}, []string{"Make", "Model"}},
+		{"defaults, plus tags with values", nil, Identity{"Model": "SIGMA fp", "LensModel": "45mm F2.8"}, []string{"Make", "Model", "LensModel"}},
+		{"configured", []string{"Model", "SerialNumber"}, Identity{"Model": "SIGMA fp"}, []string{"Model", "SerialNumber"}},
+		{"configured without Model", []string{"LensModel"}, Identity{"Model": "SIGMA fp"}, []string{"Model", "LensModel"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ManagedTags(tc.configured, tc.id); !slices.Equal(got, tc.want) {
+				t.Errorf("ManagedTags() = %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSwapArgs(t *testing.T) {
+	at := time.Date(2024, 6, 1, 14, 0, 0, 0, time.UTC)
+	state := State{Current: map[string]string{"Make": "NIKON CORPORATION", "Model": "NIKON Z 6", "SerialNumber": "6001234"}}
+	id := Profile{Make: "SIGMA", Model: "SIGMA fp", LensModel: "45mm F2.8 DG DN | C"}.Identity()
+
+	got, err := SwapArgs(state, id, ManagedTags(nil, id), "sfp", exif.Output{Suffix: true}, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"-" + exif.TagOriginalMake + "<Make", "-Make=SIGMA",
+		"-" + exif.TagOriginalCameraModel + "<Model", "-Model=SIGMA fp",
+		"-" + exif.TagOriginalLensModel + "<LensModel", "-LensModel=45mm F2.8 DG DN | C", "-XMP-aux:Lens=45mm F2.8 DG DN | C",
+		"-" + exif.TagSwappedTags + "=Make,Model,LensModel",
+		"-" + exif.TagSwapHistory + `={"at":"2024-06-01T14:00:00Z","tags":["Make","Model","LensModel"],"values":{"Make":"NIKON CORPORATION","Model":"NIKON Z 6"},"new_tags":["Make","Model","LensModel"]}`,
+		"-o", "%d%f_sfp.%e",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("SwapArgs() = %q; want %q", got, want)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	history := []HistoryEntry{
+		{
+			At:      "2024-06-01T14:00:00Z",
+			Tags:    []string{"Model", "SerialNumber"},
+			Values:  map[string]string{"Model": "NIKON Z 6"},
+			NewTags: []string{"Model", "SerialNumber"},
+		},
+		{
+			At:     "2024-06-02T09:30:00Z",
+			Tags:   []string{"Model", "SerialNumber"},
+			Values: map[string]string{"Model": "SIGMA fp", "SerialNumber": "9999"},
+		},
+	}
+	args, err := historyArgs(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantArgs := []string{
+		"-" + exif.TagSwapHistory + `={"at":"2024-06-01T14:00:00Z","tags":["Model","SerialNumber"],"values":{"Model":"NIKON Z 6"},"new_tags":["Model","SerialNumber"]}`,
+		"-" + exif.TagSwapHistory + `={"at":"2024-06-02T09:30:00Z","tags":["Model","SerialNumber"],"values":{"Model":"SIGMA fp","SerialNumber":"9999"}}`,
+	}
+	if !slices.Equal(args, wantArgs) {
+		t.Errorf("historyArgs() = %q; want %q", args, wantArgs)
+	}
+	if args, _ := historyArgs(nil); !slices.Equal(args, []string{"-" + exif.TagSwapHistory + "="}) {
+		t.Errorf("historyArgs(nil) = %q; want the history removed", args)
+	}
+
+	// what exiftool would then report for the file:
+	entries := make([]interface{}, len(args))
+	for i, arg := range args {
+		entries[i] = arg[len("-"+exif.TagSwapHistory+"="):]
+	}
+	state, err := StateFromMetadata(exif.Metadata{
+		"Model":                      "Leica Q2",
+		"SerialNumber":               "1234",
+		exif.TagOriginalCameraModel:  "NIKON Z 6",
+		exif.TagOriginalSerialNumber: "6001234",
+		exif.TagSwappedTags:          "Model,SerialNumber",
+		exif.TagSwapHistory:          entries,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state.History, history) {
+		t.Errorf("StateFromMetadata() history = %+v; want %+v", state.History, history)
+	}
+
+	for _, tc := range []struct {
+		entry int
+		tag   string
+		want  string
+	}{
+		{0, "Model", "NIKON Z 6"},
+		{0, "SerialNumber", "6001234"}, // a Private tag's original value is only stashed
+		{1, "Model", "SIGMA fp"},
+		{1, "SerialNumber", "9999"},
+		{1, "Make", ""},
+	} {
+		if got := state.History[tc.entry].PreviousValue(tc.tag, state.Originals); got != tc.want {
+			t.Errorf("History[%d].PreviousValue(%s) = %q; want %q", tc.entry, tc.tag, got, tc.want)
+		}
+	}
+
+	if _, err := StateFromMetadata(exif.Metadata{exif.TagSwapHistory: "{not json"}); err == nil {
+		t.Error("StateFromMetadata() with a malformed history entry: want an error")
+	}
+}
+
+func TestStateFromMetadataWithoutHistory(t *testing.T) {
+	// swapped by an earlier version of xtool, which only stashed the model:
+	state, err := StateFromMetadata(exif.Metadata{"Model": "SIGMA fp", exif.TagOriginalCameraModel: "NIKON Z 6"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HistoryEntry{{Tags: []string{"Model"}, Values: map[string]string{"Model": "NIKON Z 6"}, NewTags: []string{"Model"}}}
+	if !reflect.DeepEqual(state.History, want) {
+		t.Errorf("StateFromMetadata() history = %+v; want %+v", state.History, want)
+	}
+}
@@ -0,0 +1,47 @@
+package camswap
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Profile is a camera identity to swap in, as defined by an alias in xtool's camswap_aliases config.
+// In the config, a profile is either an object or, for backward compatibility, a plain string
+// giving just the camera model.
+type Profile struct {
+	Make                 string `json:"make,omitempty"`
+	Model                string `json:"model"`
+	LensMake             string `json:"lens_make,omitempty"`
+	LensModel            string `json:"lens,omitempty"`
+	SerialNumber         string `json:"serial,omitempty"`
+	InternalSerialNumber string `json:"internal_serial,omitempty"`
+	Suffix               string `json:"suffix,omitempty"` // names output files written with camswap -s; defaults to the alias
+}
+
+func (p *Profile) UnmarshalJSON(data []byte) error {
+	var model string
+	if err := json.Unmarshal(data, &model); err == nil {
+		*p = Profile{Model: model}
+		return nil
+	}
+
+	type profileFields Profile
+	var fields profileFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return errors.New("alias must be a camera model string or a profile object")
+	}
+	*p = Profile(fields)
+	return nil
+}
+
+// Identity returns the identity tag values the profile sets.
+func (p Profile) Identity() Identity {
+	return Identity{
+		"Make":                 p.Make,
+		"Model":                p.Model,
+		"LensMake":             p.LensMake,
+		"LensModel":            p.LensModel,
+		"SerialNumber":         p.SerialNumber,
+		"InternalSerialNumber": p.InternalSerialNumber,
+	}
+}
@@ -0,0 +1,82 @@
+package camswap
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Rule selects files by the camera identity they currently have, and names the alias
+// (see Profile) those files should be swapped to.
+type Rule struct {
+	Name  string    `json:"name,omitempty"`
+	Match RuleMatch `json:"match"`
+	Alias string    `json:"alias"`
+}
+
+// RuleMatch holds case-insensitive glob patterns (see path.Match) for identity tag values. Unlike
+// in path.Match, '*' and '?' also match '/', which lens names often contain (eg. "40mm f/2").
+// An empty pattern matches any value, including a missing tag.
+type RuleMatch struct {
+	Make         string `json:"make,omitempty"`
+	Model        string `json:"model,omitempty"`
+	LensModel    string `json:"lens,omitempty"`
+	SerialNumber string `json:"serial,omitempty"`
+}
+
+func (m RuleMatch) patterns() map[string]string {
+	return map[string]string{
+		"Make":         m.Make,
+		"Model":        m.Model,
+		"LensModel":    m.LensModel,
+		"SerialNumber": m.SerialNumber,
+	}
+}
+
+// Validate checks that the match sets at least one pattern, and that its patterns are well-formed.
+func (m RuleMatch) Validate() error {
+	empty := true
+	for tag, pattern := range m.patterns() {
+		if pattern == "" {
+			continue
+		}
+		empty = false
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad %s pattern '%s': %w", tag, pattern, err)
+		}
+	}
+	if empty {
+		return fmt.Errorf("match must set at least one of make, model, lens, serial")
+	}
+	return nil
+}
+
+// Matches reports whether a file with the given identity tag values (see State.Current) matches.
+func (m RuleMatch) Matches(current map[string]string) bool {
+	for tag, pattern := range m.patterns() {
+		if pattern == "" {
+			continue
+		}
+		matched, err := path.Match(slashFree(strings.ToLower(pattern)), slashFree(strings.ToLower(strings.TrimSpace(current[tag]))))
+		if err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// slashFree replaces '/' with a character identity tag values don't contain, so that path.Match
+// doesn't treat it as a separator.
+func slashFree(s string) string {
+	return strings.ReplaceAll(s, "/", "\x00")
+}
+
+// MatchRule returns the first of rules matching a file with the given identity tag values.
+func MatchRule(rules []Rule, current map[string]string) (Rule, bool) {
+	for _, rule := range rules {
+		if rule.Match.Matches(current) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
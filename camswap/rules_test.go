@@ -0,0 +1,54 @@
+package camswap
+
+import "testing"
+
+func TestMatchRule(t *testing.T) {
+	rules := []Rule{
+		{Name: "z6 with the 40mm", Match: RuleMatch{Model: "*Z 6*", LensModel: "NIKKOR Z 40mm*"}, Alias: "sfp-45"},
+		{Name: "z6", Match: RuleMatch{Make: "nikon*", Model: "*Z 6*"}, Alias: "sfp"},
+		{Name: "one fuji", Match: RuleMatch{SerialNumber: "12345"}, Alias: "x100"},
+		{Name: "q", Match: RuleMatch{Model: "Leica Q?"}, Alias: "q"},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		current  map[string]string
+		wantRule string
+	}{
+		{"first matching rule wins", map[string]string{"Make": "NIKON CORPORATION", "Model": "NIKON Z 6", "LensModel": "NIKKOR Z 40mm f/2"}, "z6 with the 40mm"},
+		{"later rule", map[string]string{"Make": "NIKON CORPORATION", "Model": "NIKON Z 6", "LensModel": "NIKKOR Z 24-70mm f/4 S"}, "z6"},
+		{"case-insensitive", map[string]string{"Make": "Nikon", "Model": "nikon z 6_2"}, "z6"},
+		{"surrounding whitespace", map[string]string{"Make": "NIKON ", "Model": " NIKON Z 6 "}, "z6"},
+		{"missing tag for a pattern", map[string]string{"Model": "NIKON Z 6"}, ""},
+		{"serial number", map[string]string{"Make": "FUJIFILM", "Model": "X100V", "SerialNumber": "12345"}, "one fuji"},
+		{"other serial number", map[string]string{"Make": "FUJIFILM", "Model": "X100V", "SerialNumber": "123456"}, ""},
+		{"single-character wildcard", map[string]string{"Model": "LEICA Q2"}, "q"},
+		{"no match", map[string]string{"Make": "Canon", "Model": "Canon EOS R5"}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, ok := MatchRule(rules, tc.current)
+			if ok != (tc.wantRule != "") || rule.Name != tc.wantRule {
+				t.Errorf("MatchRule() = %q, %v; want %q", rule.Name, ok, tc.wantRule)
+			}
+		})
+	}
+}
+
+func TestRuleMatchValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		match   RuleMatch
+		wantErr bool
+	}{
+		{"model", RuleMatch{Model: "*Z 6*"}, false},
+		{"every pattern", RuleMatch{Make: "NIKON*", Model: "*Z 6*", LensModel: "*40mm*", SerialNumber: "6*"}, false},
+		{"no patterns", RuleMatch{}, true},
+		{"malformed pattern", RuleMatch{Model: "[Z 6"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.match.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("Validate() = %v; want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package camswap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"xtool/exif"
+)
+
+// VerifySwap checks that the file at path has had id swapped in, covering tags, by a swap from
+// the camswap state before. It checks each swapped tag's new value, and that the original camera
+// model is stashed.
+func VerifySwap(ctx context.Context, et *exif.Exiftool, path string, before State, id Identity, tags []string) error {
+	after, err := ReadState(ctx, et, path)
+	if err != nil {
+		return err
+	}
+	if !after.Swapped() {
+		return errors.New("no camera swap metadata was written")
+	}
+
+	originalModel, hadModel := before.Originals["Model"]
+	if !slices.Contains(before.SwappedTags, "Model") {
+		originalModel, hadModel = before.Current["Model"]
+	}
+	if hadModel && after.Originals["Model"] != originalModel {
+		return fmt.Errorf("expected %s to be '%s', but it is '%s'", exif.TagOriginalCameraModel, originalModel, after.Originals["Model"])
+	}
+
+	expected := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		expected[tag] = id[tag]
+	}
+	return checkIdentity(after, expected)
+}
+
+// VerifyRestore checks that the file at path has had its most recent swap undone (or every swap,
+// if all is set), given its camswap state before the restore.
+func VerifyRestore(ctx context.Context, et *exif.Exiftool, path string, before State, all bool) error {
+	after, err := ReadState(ctx, et, path)
+	if err != nil {
+		return err
+	}
+
+	expected := make(map[string]string)
+	if all || len(before.History) <= 1 {
+		if after.Swapped() {
+			return errors.New("camera swap metadata is still attached")
+		}
+		for _, tag := range before.SwappedTags {
+			expected[tag] = before.Originals[tag]
+		}
+	} else {
+		if len(after.History) != len(before.History)-1 {
+			return fmt.Errorf("expected %d swap history entries, but found %d", len(before.History)-1, len(after.History))
+		}
+		last := before.History[len(before.History)-1]
+		for _, tag := range last.Tags {
+			expected[tag] = last.PreviousValue(tag, before.Originals)
+		}
+	}
+	return checkIdentity(after, expected)
+}
+
+// checkIdentity checks that each tag in expected has the expected value in state, or is absent
+// if the expected value is empty.
+func checkIdentity(state State, expected map[string]string) error {
+	for _, tag := range IdentityTags {
+		want, ok := expected[tag.Name]
+		if !ok {
+			continue
+		}
+		got, present := state.Current[tag.Name]
+		if want == "" && present {
+			return fmt.Errorf("expected %s to be removed, but it is '%s'", tag.Label, got)
+		}
+		if want != "" && got != want {
+			return fmt.Errorf("expected %s to be '%s', but it is '%s'", tag.Label, want, got)
+		}
+	}
+	return nil
+}
@@ -3,25 +3,59 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
+
+	"xtool/anonymize"
+	"xtool/camswap"
+	"xtool/geocode"
+	"xtool/geotag"
+	"xtool/rmloc"
 )
 
 //goland:noinspection GoDeprecation
 type AppConfig struct {
-	ExiftoolBin    string            `json:"exiftool_bin,omitempty"` // absolute path to exiftool
-	CamswapAliases map[string]string `json:"camswap_aliases,omitempty"`
-	NeatImage      struct {
+	ExiftoolBin           string                     `json:"exiftool_bin,omitempty"` // absolute path to exiftool
+	CamswapAliases        map[string]camswap.Profile `json:"camswap_aliases,omitempty"`
+	CamswapTags           []string                   `json:"camswap_tags,omitempty"`           // identity tags camswap always swaps (removing them if no new value is given); defaults to Make and Model, and Model is always swapped
+	CamswapRules          []camswap.Rule             `json:"camswap_rules,omitempty"`          // used by camswap -auto; the first matching rule applies
+	Places                map[string]geotag.Place    `json:"places,omitempty"`                 // used by geotag -place
+	PrivacyZones          []rmloc.Zone               `json:"privacy_zones,omitempty"`          // used by rmloc -zones and inspect -l
+	AnonymizeReplacements map[string]string          `json:"anonymize_replacements,omitempty"` // values anonymize writes in place of identifying tags; other tags are removed
+	GeoNames              *geocode.Config            `json:"geonames,omitempty"`               // offline reverse geocoding, used by inspect -l and geotag -fill-iptc
+	NeatImage             struct {
 		NeatImageBin      string `json:"neat_image_bin,omitempty"`
 		ProfilesFolder    string `json:"profiles_folder"`
 		DefaultJpgQuality int    `json:"default_jpg_quality"`
 	} `json:"neat_image,omitempty"`
-	DeprecatedX3fBin string `json:"x3f_bin,omitempty"` // deprecated; retained here for backward compatibility
-	X3fExtractBin    string `json:"x3f_extract_bin,omitempty"`
+	DeprecatedX3fBin string                 `json:"x3f_bin,omitempty"` // deprecated; retained here for backward compatibility
+	X3fExtractBin    string                 `json:"x3f_extract_bin,omitempty"`
+	WatchPresets     map[string]WatchPreset `json:"watch_presets,omitempty"`
+}
+
+// WatchPreset describes what `xtool watch` does with each new image file: either a single xtool
+// command (Command + Args) or a Pipeline of commands run in order on the file.
+type WatchPreset struct {
+	Command       string      `json:"command,omitempty"`
+	Args          []string    `json:"args,omitempty"`
+	Pipeline      []WatchStep `json:"pipeline,omitempty"`
+	Extensions    []string    `json:"extensions,omitempty"`     // file extensions to process; defaults to common image & RAW formats
+	SettleSeconds int         `json:"settle_seconds,omitempty"` // how long a file must be unchanged before it's processed; defaults to 5
+}
+
+type WatchStep struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// Steps returns the preset's pipeline; a preset using Command/Args is a single-step pipeline.
+func (p WatchPreset) Steps() []WatchStep {
+	if p.Command != "" {
+		return append([]WatchStep{{Command: p.Command, Args: p.Args}}, p.Pipeline...)
+	}
+	return p.Pipeline
 }
 
 func buildAppConfig(ctx context.Context) (AppConfig, error) {
@@ -74,120 +108,63 @@ func buildAppConfig(ctx context.Context) (AppConfig, error) {
 	}
 
 	if appConfig.CamswapAliases == nil {
-		appConfig.CamswapAliases = make(map[string]string)
-	}
-
-	// config is valid!
-	return appConfig, nil
-}
-
-func (c AppConfig) GetX3fExtractBin() string {
-	if c.X3fExtractBin != "" {
-		return c.X3fExtractBin
+		appConfig.CamswapAliases = make(map[string]camswap.Profile)
 	}
-	return c.DeprecatedX3fBin
-}
-
-type BackupsConfig struct {
-	BackupsLocation string `json:"backups_location"`         // same_dir, sub_dir, abs_path. same_dir = exiftool default; sub_dir = move exiftool backup files to a subdirectory; abs_path = move backups to a structure under an absolute path
-	BackupsFolder   string `json:"backups_folder,omitempty"` // same_dir = no effect; sub_dir = backups at ./backups_folder_TS; abs_path = backups at abs_path/TS source_folder_name
-}
-
-const (
-	backupsConfigName = ".xtoolbak.json"
-
-	BackupsLocSameDir = "same_dir"
-	BackupsLocSubDir  = "sub_dir"
-	BackupsLocAbsPath = "abs_path"
-)
-
-var backupConfigCache = make(map[string]BackupsConfig)
-
-func GetBackupConfig(filename string) (BackupsConfig, error) {
-	// Finding the applicable .xtoolbak config file, we search upward starting at the directory the image file is in:
-	// - If under `~`: search stops at ~.
-	// - If under /Volumes, /mnt, /media: search stops at the volume root.
-	// - Else: search stops at root.
-	// If no backup config file is found, a default configuration is returned.
-
-	homeDir := MustUserHomeDir()
-	absImageFilePath, err := filepath.Abs(filename)
-	if err != nil {
-		return BackupsConfig{}, fmt.Errorf("failed to find absolute path for '%s': %w", filename, err)
-	}
-	bakConfigSearchDir := filepath.Dir(absImageFilePath)
-	bakConfigSearchVolName := filepath.VolumeName(bakConfigSearchDir)
-
-	if cachedConfig, ok := backupConfigCache[bakConfigSearchDir]; ok {
-		return cachedConfig, nil
+	for alias, profile := range appConfig.CamswapAliases {
+		if profile.Model == "" {
+			return appConfig, fmt.Errorf("camswap_aliases: alias '%s' must set a model", alias)
+		}
 	}
 
-	i := 0
-	for {
-		if i > 128 {
-			return BackupsConfig{}, fmt.Errorf("failed to find a backups config for '%s' in 128 iterations", filename)
+	for i, rule := range appConfig.CamswapRules {
+		if rule.Name == "" {
+			appConfig.CamswapRules[i].Name = fmt.Sprintf("rule %d", i+1)
 		}
-
-		if bakConfigSearchDir == homeDir || bakConfigSearchDir == bakConfigSearchVolName ||
-			bakConfigSearchDir == "/" || filepath.Dir(bakConfigSearchDir) == "/Volumes" ||
-			filepath.Dir(bakConfigSearchDir) == "/mnt" || filepath.Dir(bakConfigSearchDir) == "/media" ||
-			filepath.Dir(bakConfigSearchDir) == "/usb" {
-			break
+		if err := rule.Match.Validate(); err != nil {
+			return appConfig, fmt.Errorf("camswap_rules: %s: %w", appConfig.CamswapRules[i].Name, err)
 		}
-
-		configCandidatePath := filepath.Join(bakConfigSearchDir, backupsConfigName)
-		_, err := os.Stat(configCandidatePath)
-		if err == nil {
-			break
+		if _, ok := appConfig.CamswapAliases[rule.Alias]; !ok {
+			return appConfig, fmt.Errorf("camswap_rules: %s: alias '%s' is not defined in camswap_aliases", appConfig.CamswapRules[i].Name, rule.Alias)
 		}
-
-		bakConfigSearchDir = filepath.Dir(bakConfigSearchDir)
-		i++
 	}
 
-	// Read and parse the relevant .xtoolbak file (or set a default config if none is found):
-
-	backupsConfig := BackupsConfig{}
-	backupsConfigPath := filepath.Join(bakConfigSearchDir, backupsConfigName)
-	backupsConfigBytes, err := os.ReadFile(backupsConfigPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			backupsConfig.BackupsLocation = BackupsLocSameDir
-		} else {
-			return backupsConfig, fmt.Errorf("failed to read '%s': %w", backupsConfigPath, err)
-		}
-	} else {
-		err = json.Unmarshal(backupsConfigBytes, &backupsConfig)
-		if err != nil {
-			return backupsConfig, fmt.Errorf("failed to parse '%s' as JSON: %w", backupsConfigPath, err)
+	for _, tag := range appConfig.CamswapTags {
+		if !camswap.IsIdentityTag(tag) {
+			return appConfig, fmt.Errorf("camswap_tags: '%s' is not a camera identity tag xtool can swap", tag)
 		}
 	}
 
-	// Validate backups config:
-
-	if backupsConfig.BackupsLocation != BackupsLocSameDir && backupsConfig.BackupsLocation != BackupsLocSubDir && backupsConfig.BackupsLocation != BackupsLocAbsPath {
-		return backupsConfig, fmt.Errorf("backups_location must be one of (same_dir, sub_dir, abs_path); got '%s'", backupsConfig.BackupsLocation)
+	for name, place := range appConfig.Places {
+		if err := place.Validate(); err != nil {
+			return appConfig, fmt.Errorf("places: '%s': %w", name, err)
+		}
 	}
 
-	if backupsConfig.BackupsLocation == BackupsLocSubDir && backupsConfig.BackupsFolder == "" {
-		return backupsConfig, errors.New("'backups_location: sub_dir' requires setting a backups_folder, to name the backups subdirectory")
+	for _, zone := range appConfig.PrivacyZones {
+		if err := zone.Validate(); err != nil {
+			return appConfig, fmt.Errorf("privacy_zones: %w", err)
+		}
 	}
 
-	if backupsConfig.BackupsLocation == BackupsLocSubDir && strings.Contains(backupsConfig.BackupsFolder, string(os.PathSeparator)) {
-		return backupsConfig, errors.New("backups_folder must be a simple directory name for 'backups_location: sub_dir'")
+	if appConfig.GeoNames != nil {
+		if err := appConfig.GeoNames.Validate(); err != nil {
+			return appConfig, fmt.Errorf("geonames: %w", err)
+		}
 	}
 
-	if backupsConfig.BackupsLocation == BackupsLocAbsPath {
-		if backupsConfig.BackupsFolder == "" {
-			return backupsConfig, errors.New("'backups_location: abs_path' requires setting backups_folder to an absolute path")
-		}
-		if stat, err := os.Stat(backupsConfig.BackupsFolder); err != nil {
-			return backupsConfig, fmt.Errorf("bad backups_folder '%s': %s", backupsConfig.BackupsFolder, err)
-		} else if !stat.IsDir() {
-			return backupsConfig, fmt.Errorf("bad backups_folder '%s': is not a directory", backupsConfig.BackupsFolder)
+	for tag := range appConfig.AnonymizeReplacements {
+		if !anonymize.IsTag(tag) {
+			return appConfig, fmt.Errorf("anonymize_replacements: '%s' is not a tag anonymize handles", tag)
 		}
 	}
 
-	backupConfigCache[filepath.Dir(absImageFilePath)] = backupsConfig
-	return backupsConfig, nil
+	// config is valid!
+	return appConfig, nil
+}
+
+func (c AppConfig) GetX3fExtractBin() string {
+	if c.X3fExtractBin != "" {
+		return c.X3fExtractBin
+	}
+	return c.DeprecatedX3fBin
 }
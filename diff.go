@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/google/subcommands"
+
+	"xtool/backup"
+	"xtool/diff"
+)
+
+type diffCmd struct {
+	backup    bool
+	appConfig AppConfig
+}
+
+func (*diffCmd) Name() string { return "diff" }
+func (*diffCmd) Synopsis() string {
+	return "Compare the metadata of two files, or a file and its backup."
+}
+
+func (*diffCmd) Usage() string {
+	return `diff a.jpg b.jpg
+diff -backup file.jpg:
+  Shows the metadata tags added, removed, or changed from the first file to the second, grouped
+  by EXIF, XMP, IPTC, MakerNotes, etc., and confirms the files' image data is identical. File
+  system attributes (size, dates, permissions) are not compared.
+  With -backup, compares the file's most recent backup, found per its backups config, to the file;
+  this shows what the last camswap, rmloc, etc. changed. With same_dir backups (the default),
+  exiftool keeps only the first backup (photo.jpg_original), so this instead shows everything
+  changed since the file was first modified.
+  Exits with a failure status if the image data differs. Checking the image data requires
+  exiftool 12.58 or later.
+`
+}
+
+func (p *diffCmd) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&p.backup, "backup", false, "Compare the file's most recent backup to the file.")
+}
+
+func (p *diffCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if (p.backup && len(f.Args()) != 1) || (!p.backup && len(f.Args()) != 2) {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	before, after := f.Arg(0), f.Arg(1)
+	if p.backup {
+		after = f.Arg(0)
+		var err error
+		if before, err = backup.Newest(after); err != nil {
+			if errors.Is(err, backup.ErrNoBackup) {
+				ErrPrintf(ctx, "no backup of %s found\n", after)
+			} else {
+				ErrPrintf(ctx, "failed to find the backup of %s: %s\n", after, err)
+			}
+			return subcommands.ExitFailure
+		}
+	}
+
+	p.appConfig = AppConfigFromCtx(ctx)
+
+	et, err := newExiftool(p.appConfig, false)
+	if err != nil {
+		ErrPrint(ctx, err)
+		return subcommands.ExitFailure
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer func() { _ = et.Close() }()
+
+	beforeMetadata, err := diff.Read(ctx, et, before)
+	if err != nil {
+		ErrPrintf(ctx, "failed to read %s: %s\n", before, err)
+		return subcommands.ExitFailure
+	}
+	afterMetadata, err := diff.Read(ctx, et, after)
+	if err != nil {
+		ErrPrintf(ctx, "failed to read %s: %s\n", after, err)
+		return subcommands.ExitFailure
+	}
+	result := diff.Compare(beforeMetadata, afterMetadata)
+
+	boldWhitePrintf := color.New(color.Bold, color.FgWhite).PrintfFunc()
+	boldGreenPrintf := color.New(color.FgGreen).PrintfFunc()
+	boldRedPrintf := color.New(color.Bold, color.FgRed).PrintfFunc()
+
+	fmt.Printf("%s %s\n", color.RedString("---"), before)
+	fmt.Printf("%s %s\n\n", color.GreenString("+++"), after)
+
+	if len(result.Changes) == 0 {
+		boldGreenPrintf("✔ No metadata differences.\n")
+	}
+	for _, group := range result.Groups() {
+		boldWhitePrintf("%s:\n", group)
+		for _, c := range result.Changes {
+			if c.Group != group {
+				continue
+			}
+			switch c.Kind {
+			case diff.Added:
+				fmt.Printf("\t%s %s %s\n", color.GreenString("+"), color.MagentaString("%s:", c.Tag), c.After)
+			case diff.Removed:
+				fmt.Printf("\t%s %s %s\n", color.RedString("-"), color.MagentaString("%s:", c.Tag), c.Before)
+			case diff.Changed:
+				fmt.Printf("\t%s %s %s → %s\n", color.YellowString("~"), color.MagentaString("%s:", c.Tag), c.Before, c.After)
+			}
+		}
+	}
+	fmt.Println()
+
+	if !result.ImageDataChecked {
+		fmt.Printf("%s exiftool couldn't hash the image data of these files\n", color.YellowString("Image data not compared:"))
+	} else if result.ImageDataSame {
+		boldGreenPrintf("✔ Image data is identical.\n")
+	} else {
+		boldRedPrintf("⚠ Image data differs.\n")
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,135 @@
+// Package diff compares the metadata of two image files, such as a file modified by xtool and
+// its backup, and checks that their image data is identical.
+package diff
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"xtool/exif"
+)
+
+// Change kinds.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// imageDataHashTag is exiftool's hash of a file's image data, excluding its metadata. exiftool
+// only computes it when it's requested, and only since version 12.58.
+const imageDataHashTag = "ImageDataHash"
+
+// ignoredGroups are the family 0 groups whose tags are expected to differ between a file and a
+// modified copy of it (file system attributes like size and modification date) or are derived
+// from other tags.
+var ignoredGroups = []string{"SourceFile", "File", "Composite", "ExifTool"}
+
+// TagChange is a difference in one tag between two files.
+type TagChange struct {
+	Kind   string // Added, Removed, or Changed
+	Group  string // family 0 group: EXIF, XMP, IPTC, MakerNotes, etc.
+	Tag    string // family 1 group and tag name, eg. "IFD0:Model"
+	Before string // empty if Added
+	After  string // empty if Removed
+}
+
+// Result is the difference between two files.
+type Result struct {
+	Changes []TagChange // sorted by group, then tag
+
+	// ImageDataChecked is set if the image data was compared; it can't be if exiftool doesn't
+	// support ImageDataHash for the files' format, or is too old to support it at all.
+	ImageDataChecked bool
+	ImageDataSame    bool
+}
+
+// Groups returns the family 0 groups with changes, sorted.
+func (r Result) Groups() []string {
+	var groups []string
+	for _, c := range r.Changes {
+		if len(groups) == 0 || groups[len(groups)-1] != c.Group {
+			groups = append(groups, c.Group)
+		}
+	}
+	return groups
+}
+
+// Read reads file's metadata for Compare.
+func Read(ctx context.Context, et *exif.Exiftool, file string) (exif.Metadata, error) {
+	// -G0:1 prefixes each tag with its family 0 and 1 groups, eg. "EXIF:IFD0:Model":
+	result, err := et.ReadJSON(ctx, []string{"-a", "-G0:1", "-api", "RequestTags=" + imageDataHashTag}, file)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) != 1 {
+		return nil, fmt.Errorf("invalid exiftool output: expected 1 item, got %d", len(result))
+	}
+	return result[0], nil
+}
+
+// Compare returns the differences from the metadata before to after, each read with Read.
+func Compare(before, after exif.Metadata) Result {
+	var r Result
+	beforeHash, beforeOK := hash(before)
+	afterHash, afterOK := hash(after)
+	if beforeOK && afterOK {
+		r.ImageDataChecked = true
+		r.ImageDataSame = beforeHash == afterHash
+	}
+
+	beforeTags, afterTags := tags(before), tags(after)
+	for key, beforeValue := range beforeTags {
+		group, tag := splitKey(key)
+		if afterValue, ok := afterTags[key]; !ok {
+			r.Changes = append(r.Changes, TagChange{Kind: Removed, Group: group, Tag: tag, Before: beforeValue})
+		} else if afterValue != beforeValue {
+			r.Changes = append(r.Changes, TagChange{Kind: Changed, Group: group, Tag: tag, Before: beforeValue, After: afterValue})
+		}
+	}
+	for key, afterValue := range afterTags {
+		if _, ok := beforeTags[key]; !ok {
+			group, tag := splitKey(key)
+			r.Changes = append(r.Changes, TagChange{Kind: Added, Group: group, Tag: tag, After: afterValue})
+		}
+	}
+	sort.Slice(r.Changes, func(i, j int) bool {
+		if r.Changes[i].Group != r.Changes[j].Group {
+			return r.Changes[i].Group < r.Changes[j].Group
+		}
+		return r.Changes[i].Tag < r.Changes[j].Tag
+	})
+	return r
+}
+
+func hash(m exif.Metadata) (string, bool) {
+	for key := range m {
+		if key == imageDataHashTag || strings.HasSuffix(key, ":"+imageDataHashTag) {
+			return m.String(key)
+		}
+	}
+	return "", false
+}
+
+// tags returns m's values as strings, omitting ignoredGroups.
+func tags(m exif.Metadata) map[string]string {
+	values := make(map[string]string, len(m))
+	for key := range m {
+		if group, _ := splitKey(key); slices.Contains(ignoredGroups, group) {
+			continue
+		}
+		values[key] = strings.Join(m.Strings(key), ", ")
+	}
+	return values
+}
+
+// splitKey splits a key read with -G0:1 into its family 0 group, and the rest.
+func splitKey(key string) (string, string) {
+	if group, rest, ok := strings.Cut(key, ":"); ok {
+		return group, rest
+	}
+	return key, key
+}
@@ -0,0 +1,69 @@
+package exif
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateTimeLayout is the layout of EXIF date/time tags such as DateTimeOriginal.
+const DateTimeLayout = "2006:01:02 15:04:05"
+
+var offsetRegexp = regexp.MustCompile(`^([+-])(\d{1,2}):?(\d{2})$`)
+
+// ParseDateTime parses the value of an EXIF date/time tag, in loc.
+func ParseDateTime(value string, loc *time.Location) (time.Time, error) {
+	// some cameras write sub-seconds or a time zone after the time; they're read from other tags:
+	if len(value) > len(DateTimeLayout) {
+		value = value[:len(DateTimeLayout)]
+	}
+	t, err := time.ParseInLocation(DateTimeLayout, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date/time '%s': %w", value, err)
+	}
+	return t, nil
+}
+
+// FormatDateTime formats t as the value of an EXIF date/time tag.
+func FormatDateTime(t time.Time) string {
+	return t.Format(DateTimeLayout)
+}
+
+// ParseOffset parses a UTC offset such as "+02:00" or "-0500", as in the OffsetTime* tags,
+// returning a fixed time zone.
+func ParseOffset(offset string) (*time.Location, error) {
+	if offset == "Z" {
+		return time.UTC, nil
+	}
+	m := offsetRegexp.FindStringSubmatch(strings.TrimSpace(offset))
+	if m == nil {
+		return nil, fmt.Errorf("invalid UTC offset '%s'", offset)
+	}
+	hours, _ := strconv.Atoi(m[2])
+	minutes, _ := strconv.Atoi(m[3])
+	seconds := hours*3600 + minutes*60
+	if m[1] == "-" {
+		seconds = -seconds
+	}
+	return time.FixedZone(offset, seconds), nil
+}
+
+// FormatOffset formats t's UTC offset as the value of an OffsetTime* tag, such as "+02:00".
+func FormatOffset(t time.Time) string {
+	return t.Format("-07:00")
+}
+
+// ParseTimeZone parses a time zone given either as an IANA name (such as "America/Detroit") or
+// as a UTC offset (see ParseOffset).
+func ParseTimeZone(tz string) (*time.Location, error) {
+	if loc, err := ParseOffset(tz); err == nil {
+		return loc, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone '%s'", tz)
+	}
+	return loc, nil
+}
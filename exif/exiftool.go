@@ -0,0 +1,225 @@
+// Package exif runs exiftool to read and modify image metadata.
+package exif
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Exiftool runs the exiftool binary at Bin, with xtool's custom XMP tags defined.
+type Exiftool struct {
+	Bin string
+
+	// Trace, if set, is called with the command line of each exiftool invocation before it runs.
+	Trace func(cmdline string)
+
+	configFile string
+}
+
+// New returns an Exiftool for the given binary. It writes a temporary exiftool config file
+// defining xtool's XMP tags; call Close to remove it.
+func New(bin string) (*Exiftool, error) {
+	configFile, err := os.CreateTemp("", "xtool_xmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exiftool XMP config file: %w", err)
+	}
+	if _, err = configFile.Write([]byte(xtoolXmpConfig)); err != nil {
+		_ = configFile.Close()
+		return nil, fmt.Errorf("failed to write exiftool XMP config file: %w", err)
+	}
+	if err = configFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close exiftool XMP config file: %w", err)
+	}
+	return &Exiftool{Bin: bin, configFile: configFile.Name()}, nil
+}
+
+// Close removes the temporary exiftool config file.
+func (e *Exiftool) Close() error {
+	return os.Remove(e.configFile)
+}
+
+// Run runs exiftool with the given args and returns its combined output.
+func (e *Exiftool) Run(ctx context.Context, args ...string) (string, error) {
+	cmd := e.command(ctx, args)
+	cmdOut, err := cmd.CombinedOutput()
+	cmdOutStr := strings.TrimSpace(string(cmdOut))
+	if err != nil {
+		var exitError *exec.ExitError
+		if !errors.As(err, &exitError) {
+			return "", fmt.Errorf("failed to run %s: %w", filepath.Base(e.Bin), err)
+		}
+		return cmdOutStr, fmt.Errorf("%s error: %s", filepath.Base(e.Bin), cmdOutStr)
+	}
+	return cmdOutStr, nil
+}
+
+// ReadJSON runs exiftool -j with the given args on files, and returns the metadata it reports
+// for each file.
+func (e *Exiftool) ReadJSON(ctx context.Context, args []string, files ...string) ([]Metadata, error) {
+	fullArgs := append([]string{"-j"}, args...)
+	fullArgs = append(fullArgs, files...)
+	cmd := e.command(ctx, fullArgs)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	cmdOut, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w: %s", filepath.Base(e.Bin), err, strings.TrimSpace(stderr.String()))
+	}
+	var result []Metadata
+	if err := json.Unmarshal(cmdOut, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse %s result as JSON: %w", filepath.Base(e.Bin), err)
+	}
+	return result, nil
+}
+
+// ReadJSONEach runs exiftool -j with the given args on files in a single invocation, and returns
+// the metadata it reports for each file, keyed by file name. Unlike ReadJSON, a file exiftool
+// can't read doesn't fail the whole invocation; its error is returned in errs instead.
+// The file names are passed on stdin, so there's no limit to how many can be read at once.
+func (e *Exiftool) ReadJSONEach(ctx context.Context, args []string, files []string) (map[string]Metadata, map[string]error, error) {
+	fullArgs := append([]string{"-j"}, args...)
+	if runtime.GOOS == "windows" {
+		fullArgs = append(fullArgs, "-charset", "filename=UTF8")
+	}
+	cmd := e.command(ctx, append(fullArgs, "-@", "-"))
+	var argFile strings.Builder
+	for _, file := range files {
+		// exiftool treats argument file lines starting with # as comments:
+		if strings.HasPrefix(file, "#") {
+			file = "." + string(os.PathSeparator) + file
+		}
+		argFile.WriteString(file + "\n")
+	}
+	cmd.Stdin = strings.NewReader(argFile.String())
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	cmdOut, err := cmd.Output()
+	if err != nil {
+		// exiftool exits 1 if any file couldn't be read, but still reports the others:
+		var exitError *exec.ExitError
+		if !errors.As(err, &exitError) || exitError.ExitCode() != 1 {
+			return nil, nil, fmt.Errorf("failed to run %s: %w: %s", filepath.Base(e.Bin), err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	var result []Metadata
+	if len(strings.TrimSpace(string(cmdOut))) != 0 {
+		if err := json.Unmarshal(cmdOut, &result); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s result as JSON: %w", filepath.Base(e.Bin), err)
+		}
+	}
+
+	// exiftool echoes each file name as SourceFile, with / as the path separator on every platform:
+	reported := make(map[string]Metadata, len(result))
+	for _, m := range result {
+		file, _ := m.String("SourceFile")
+		reported[normalizePath(file)] = m
+	}
+
+	metadata := make(map[string]Metadata, len(files))
+	errs := make(map[string]error)
+	for _, file := range files {
+		m, ok := reported[normalizePath(file)]
+		if !ok {
+			errs[file] = fmt.Errorf("%s error: %s", filepath.Base(e.Bin), stderrFor(stderr.String(), file))
+		} else if msg, ok := m.String("Error"); ok {
+			errs[file] = fmt.Errorf("%s error: %s", filepath.Base(e.Bin), msg)
+		} else {
+			metadata[file] = m
+		}
+	}
+	return metadata, errs, nil
+}
+
+// normalizePath returns path cleaned, with / as its separator, for comparing the file names
+// given to exiftool with those it reports.
+func normalizePath(path string) string {
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
+// stderrFor returns the line of exiftool's stderr output reporting an error with file
+// (eg. "Error: File not found - a.jpg"), or a generic message if there is none.
+func stderrFor(stderr string, file string) string {
+	for _, line := range strings.Split(stderr, "\n") {
+		if _, reportedFile, ok := strings.Cut(strings.TrimSpace(line), " - "); ok && normalizePath(reportedFile) == normalizePath(file) {
+			return strings.TrimSpace(line)
+		}
+	}
+	return "no metadata reported for " + file
+}
+
+// ExtractBinary returns the value of the given binary tag (eg. PreviewImage) in file.
+// It returns an empty slice if file doesn't have the tag.
+func (e *Exiftool) ExtractBinary(ctx context.Context, tag string, file string) ([]byte, error) {
+	cmd := e.command(ctx, []string{"-b", "-" + tag, file})
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	cmdOut, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w: %s", filepath.Base(e.Bin), err, strings.TrimSpace(stderr.String()))
+	}
+	return cmdOut, nil
+}
+
+func (e *Exiftool) command(ctx context.Context, args []string) *exec.Cmd {
+	// -config must be the first argument:
+	fullArgs := append([]string{"-config", e.configFile}, args...)
+	if e.Trace != nil {
+		e.Trace(fmt.Sprintf("%s %s", e.Bin, strings.Join(fullArgs, " ")))
+	}
+	return exec.CommandContext(ctx, e.Bin, fullArgs...)
+}
+
+// Metadata is one file's entry in exiftool's JSON output, mapping tag names to values.
+type Metadata map[string]interface{}
+
+// TagName strips the group from a group-qualified tag name, eg. "EXIF:Model" -> "Model".
+func TagName(key string) string {
+	if i := strings.LastIndex(key, ":"); i != -1 {
+		return key[i+1:]
+	}
+	return key
+}
+
+// String returns the given tag's value formatted as a string, and whether the tag is present.
+func (m Metadata) String(tag string) (string, bool) {
+	v, ok := m[tag]
+	if !ok || v == nil {
+		return "", false
+	}
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		// exiftool reports numeric-looking values (eg. serial numbers) as JSON numbers:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return fmt.Sprint(v), true
+}
+
+// Strings returns the values of the given list-type tag. exiftool reports a list with a single
+// item as a plain value, so this also accepts non-list values.
+func (m Metadata) Strings(tag string) []string {
+	items, ok := m[tag].([]interface{})
+	if !ok {
+		if s, ok := m.String(tag); ok {
+			return []string{s}
+		}
+		return nil
+	}
+	values := make([]string, 0, len(items))
+	for i := range items {
+		if s, ok := (Metadata{tag: items[i]}).String(tag); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
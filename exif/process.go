@@ -0,0 +1,111 @@
+package exif
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"xtool/backup"
+)
+
+// Output controls where modified images are written. The zero value modifies images in place.
+type Output struct {
+	Dir    string // write modified images to this directory
+	Suffix bool   // write modified images to new files named with a suffix
+}
+
+// Args returns the exiftool arguments that write to o, naming new files with the given suffix
+// (eg. photo_noGPS.jpg) if o.Suffix is set.
+func (o Output) Args(suffix string) []string {
+	if o.Dir != "" && o.Suffix {
+		return []string{"-o", fmt.Sprintf("%s%s%%f_%s.%%e", o.Dir, string(os.PathSeparator), suffix)}
+	} else if o.Suffix {
+		return []string{"-o", fmt.Sprintf("%%d%%f_%s.%%e", suffix)}
+	} else if o.Dir != "" {
+		return []string{"-o", fmt.Sprintf("%s%s", o.Dir, string(os.PathSeparator))}
+	}
+	return nil
+}
+
+// Result describes the outcome of modifying one file with exiftool.
+type Result struct {
+	File       string
+	OutputPath string // the modified file: File itself, or the new file exiftool wrote (see OutputPath)
+	Output     string // exiftool's output
+	BackupPath string // where exiftool's backup of the original file ended up, if one was made
+	Warning    error  // a non-fatal problem encountered after exiftool succeeded
+	SkipReason string // set if the file was deliberately left unchanged
+	Err        error
+}
+
+// ProcessFile runs exiftool with the given args on file. If exiftool backed up the original
+// file, the backup is moved to the backups folder configured for the file (see backup.ConfigFor).
+// startTime names the backups folder, so it should be shared by every file in a batch.
+func (e *Exiftool) ProcessFile(ctx context.Context, args []string, file string, startTime time.Time) Result {
+	res := Result{File: file, OutputPath: OutputPath(args, file)}
+
+	fullArgs := make([]string, len(args)+1)
+	copy(fullArgs, args)
+	fullArgs[len(args)] = file
+
+	res.Output, res.Err = e.Run(ctx, fullArgs...)
+	if res.Err != nil {
+		return res
+	}
+
+	exiftoolBackupFilename := fmt.Sprintf("%s_original", file)
+	if _, err := os.Stat(exiftoolBackupFilename); err != nil {
+		// if the backup file was not created, there's nothing to do. (supports -o)
+		if !os.IsNotExist(err) {
+			res.Warning = fmt.Errorf("could not stat exiftool backup file '%s': %w", exiftoolBackupFilename, err)
+		}
+		return res
+	}
+
+	res.BackupPath, res.Err = backup.Store(file, exiftoolBackupFilename, startTime)
+	return res
+}
+
+// OutputPath returns the path of the file exiftool writes when run with args on file: file
+// itself, unless args include -o. Only the %d, %f and %e format codes are supported in -o.
+func OutputPath(args []string, file string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] != "-o" {
+			continue
+		}
+		dir := filepath.Dir(file)
+		if dir == "." {
+			dir = ""
+		} else {
+			dir += string(os.PathSeparator)
+		}
+		ext := filepath.Ext(file)
+		outPath := strings.NewReplacer(
+			"%d", dir,
+			"%f", strings.TrimSuffix(filepath.Base(file), ext),
+			"%e", strings.TrimPrefix(ext, "."),
+		).Replace(args[i+1])
+		if strings.HasSuffix(outPath, string(os.PathSeparator)) {
+			return filepath.Join(outPath, filepath.Base(file))
+		}
+		return outPath
+	}
+	return file
+}
+
+// Process runs exiftool with the given args on each of files in turn, as ProcessFile does.
+func (e *Exiftool) Process(ctx context.Context, args []string, files []string) []Result {
+	startTime := time.Now()
+	results := make([]Result, 0, len(files))
+	for _, file := range files {
+		if ctx.Err() != nil {
+			results = append(results, Result{File: file, Err: ctx.Err()})
+			continue
+		}
+		results = append(results, e.ProcessFile(ctx, args, file, startTime))
+	}
+	return results
+}
@@ -0,0 +1,65 @@
+package exif
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Verify runs check on the file res describes, if it was modified successfully. exiftool can
+// silently skip tags it can't write, so check should re-read the file and confirm the expected
+// changes landed. If check fails, the modification is reverted (see Revert) and res is marked failed.
+func Verify(ctx context.Context, res Result, check func(ctx context.Context, path string) error) Result {
+	if res.Err != nil || res.SkipReason != "" {
+		return res
+	}
+	if err := check(ctx, res.OutputPath); err != nil {
+		if revertErr := Revert(res); revertErr != nil {
+			res.Err = fmt.Errorf("verification failed: %w (reverting the change also failed: %s)", err, revertErr)
+		} else {
+			res.Err = fmt.Errorf("verification failed, so the change was reverted: %w", err)
+		}
+	}
+	return res
+}
+
+// Revert undoes the modification res describes. A new output file is removed; a file modified
+// in place is restored from its backup.
+func Revert(res Result) error {
+	if res.OutputPath != res.File {
+		return os.Remove(res.OutputPath)
+	}
+	if res.BackupPath == "" {
+		return errors.New("no backup of the original file was made")
+	}
+	if err := os.Rename(res.BackupPath, res.File); err == nil {
+		return nil
+	}
+
+	// the backups folder may be on another volume:
+	if err := copyFile(res.BackupPath, res.File); err != nil {
+		return fmt.Errorf("failed to restore '%s' from backup '%s': %w", res.File, res.BackupPath, err)
+	}
+	return os.Remove(res.BackupPath)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer func() { _ = in.Close() }()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,46 @@
+package exif
+
+// xtool's custom XMP tags. camswap stashes each original camera identity tag in its own
+// XtoolOriginal* tag, and records which identity tags it swapped in XtoolSwappedTags.
+// XtoolSwapHistory is a sequence with one JSON-encoded entry per camswap applied to the file.
+// anonymize stashes the original values of every tag it changed, JSON-encoded and optionally
+// encrypted, in XtoolAnonymizedOriginals. rmloc -coarsen records the grid size, in degrees, a
+// location was rounded to in XtoolLocationPrecision, and rmloc -stash -encrypt stashes the removed
+// location tags, JSON-encoded and encrypted, in XtoolLocationStash. timeshift stashes the
+// original values of every date/time tag it changed, JSON-encoded, in XtoolOriginalTimes.
+const (
+	TagOriginalMake                 = "XtoolOriginalMake"
+	TagOriginalCameraModel          = "XtoolOriginalCameraModel"
+	TagOriginalLensMake             = "XtoolOriginalLensMake"
+	TagOriginalLensModel            = "XtoolOriginalLensModel"
+	TagOriginalSerialNumber         = "XtoolOriginalSerialNumber"
+	TagOriginalInternalSerialNumber = "XtoolOriginalInternalSerialNumber"
+	TagSwappedTags                  = "XtoolSwappedTags"
+	TagSwapHistory                  = "XtoolSwapHistory"
+	TagAnonymizedOriginals          = "XtoolAnonymizedOriginals"
+	TagLocationPrecision            = "XtoolLocationPrecision"
+	TagLocationStash                = "XtoolLocationStash"
+	TagOriginalTimes                = "XtoolOriginalTimes"
+)
+
+// xtoolXmpConfig is an exiftool config file defining xtool's custom XMP tags.
+const xtoolXmpConfig = `
+%Image::ExifTool::UserDefined = (
+    'Image::ExifTool::XMP::xmp' => {
+        XtoolOriginalMake => { },
+        XtoolOriginalCameraModel => { },
+        XtoolOriginalLensMake => { },
+        XtoolOriginalLensModel => { },
+        XtoolOriginalSerialNumber => { },
+        XtoolOriginalInternalSerialNumber => { },
+        XtoolSwappedTags => { },
+        XtoolSwapHistory => { List => 'Seq' },
+        XtoolAnonymizedOriginals => { },
+        XtoolLocationPrecision => { },
+        XtoolLocationStash => { },
+        XtoolOriginalTimes => { },
+    },
+);
+
+1;
+`
@@ -3,14 +3,15 @@ package main
 import (
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
 	"time"
+
+	"xtool/exif"
 )
 
-// ExiftoolProcess returns list of files successfully processed, and map of filename -> error.
-func ExiftoolProcess(ctx context.Context, args []string, files []string, appConfig AppConfig, verbose bool, verbose2 bool) ([]string, map[string]error) {
+// ExiftoolProcess calls process on each file in turn, printing progress and errors as it goes.
+// It returns list of files successfully processed, and map of filename -> error. Files process
+// skips are in neither.
+func ExiftoolProcess(ctx context.Context, files []string, verbose bool, verbose2 bool, process func(imgFilename string, startTime time.Time) exif.Result) ([]string, map[string]error) {
 	var successes []string
 	errs := make(map[string]error)
 	startTime := time.Now()
@@ -18,62 +19,30 @@ func ExiftoolProcess(ctx context.Context, args []string, files []string, appConf
 	for _, imgFilename := range files {
 		fmt.Printf("%s ...\n", imgFilename)
 
-		fullArgs := make([]string, len(args)+1)
-		copy(fullArgs, args)
-		fullArgs[len(args)] = imgFilename
-
-		if verbose2 {
-			fmt.Printf("%s %s\n", appConfig.ExiftoolBin, strings.Join(fullArgs, " "))
-		}
-
-		cmdOut, err := RunCmd(appConfig.ExiftoolBin, fullArgs)
-		if err != nil {
-			errs[imgFilename] = err
+		res := process(imgFilename, startTime)
+		if res.Err != nil {
+			errs[imgFilename] = res.Err
 			ErrPrint(ctx, errs[imgFilename])
 			continue
 		}
+		if res.SkipReason != "" {
+			fmt.Printf("skipped: %s\n", res.SkipReason)
+			continue
+		}
 		if verbose {
-			fmt.Println(cmdOut)
+			fmt.Println(res.Output)
+		}
+		if res.Warning != nil {
+			ErrPrint(ctx, res.Warning)
 		}
 
-		exiftoolBackupFilename := fmt.Sprintf("%s_original", imgFilename)
-		_, err = os.Stat(exiftoolBackupFilename)
-		if err != nil {
-			if os.IsNotExist(err) {
-				// backup file was not created; move on. (supports -s)
-				if verbose2 {
-					fmt.Printf("exiftool backup file '%s' does not exist; nothing to do\n", exiftoolBackupFilename)
-				}
-			} else {
-				ErrPrintln(ctx, "could not stat exiftool backup file '%s': %s\n", exiftoolBackupFilename, err)
-			}
-		} else {
-			backupsConfig, err := GetBackupConfig(imgFilename)
-			if err != nil {
-				errs[imgFilename] = fmt.Errorf("failed to get backups config: %w", err)
-				ErrPrint(ctx, errs[imgFilename])
-				continue
-			}
-			backupsPath, err := backupsConfig.PrepareBackupsDir(imgFilename, startTime)
-			if err != nil {
-				errs[imgFilename] = fmt.Errorf("failed to prepare backups folder: %w", err)
-				ErrPrint(ctx, errs[imgFilename])
-				continue
-			}
-			if backupsPath != "" {
-				newBackupFilePath := filepath.Join(backupsPath, filepath.Base(imgFilename))
-				err = os.Rename(
-					exiftoolBackupFilename,
-					newBackupFilePath,
-				)
-				if err != nil {
-					errs[imgFilename] = fmt.Errorf("failed to move backup file '%s' to the backups folder: %w", exiftoolBackupFilename, err)
-					ErrPrint(ctx, errs[imgFilename])
-					continue
-				}
-				if verbose2 {
-					fmt.Printf("Moved exiftool backup file '%s' to '%s'.", exiftoolBackupFilename, newBackupFilePath)
-				}
+		if verbose2 {
+			exiftoolBackupFilename := fmt.Sprintf("%s_original", imgFilename)
+			if res.BackupPath == "" {
+				// backup file was not created; nothing to do. (supports -s)
+				fmt.Printf("exiftool backup file '%s' does not exist; nothing to do\n", exiftoolBackupFilename)
+			} else if res.BackupPath != exiftoolBackupFilename {
+				fmt.Printf("Moved exiftool backup file '%s' to '%s'.\n", exiftoolBackupFilename, res.BackupPath)
 			}
 		}
 
@@ -82,3 +51,16 @@ func ExiftoolProcess(ctx context.Context, args []string, files []string, appConf
 
 	return successes, errs
 }
+
+// newExiftool returns an exif.Exiftool for the configured exiftool binary, which prints
+// each exiftool command line when verbose2 is set. The caller must Close it.
+func newExiftool(appConfig AppConfig, verbose2 bool) (*exif.Exiftool, error) {
+	et, err := exif.New(appConfig.ExiftoolBin)
+	if err != nil {
+		return nil, err
+	}
+	if verbose2 {
+		et.Trace = func(cmdline string) { fmt.Println(cmdline) }
+	}
+	return et, nil
+}
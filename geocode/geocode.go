@@ -0,0 +1,215 @@
+// Package geocode reverse geocodes GPS locations offline, finding the nearest city in a local
+// copy of the GeoNames cities dataset (https://download.geonames.org/export/dump/).
+package geocode
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"xtool/rmloc"
+)
+
+const defaultMaxDistanceKm = 50
+
+// Config locates the GeoNames files to reverse geocode with.
+type Config struct {
+	Cities        string  `json:"cities"`                    // a GeoNames cities file, eg. cities1000.txt
+	Admin1Codes   string  `json:"admin1_codes,omitempty"`    // admin1CodesASCII.txt, for state & region names; without it, places have no region name
+	CountryInfo   string  `json:"country_info,omitempty"`    // countryInfo.txt, for country names; without it, places have only a country code
+	MaxDistanceKm float64 `json:"max_distance_km,omitempty"` // locations farther than this from any city aren't geocoded; defaults to 50
+}
+
+func (c Config) Validate() error {
+	if c.Cities == "" {
+		return errors.New("cities must be set to a GeoNames cities file")
+	}
+	for _, path := range []string{c.Cities, c.Admin1Codes, c.CountryInfo} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+	if c.MaxDistanceKm < 0 {
+		return errors.New("max_distance_km must not be negative")
+	}
+	return nil
+}
+
+// Place is the city nearest a location. Region and Country are empty if their names aren't
+// known; the codes GeoNames identifies them by are kept separately, as they aren't names.
+type Place struct {
+	City           string  `json:"city"`
+	Region         string  `json:"region"` // state, province, etc.
+	RegionCode     string  `json:"region_code"`
+	Country        string  `json:"country"`
+	CountryCode    string  `json:"country_code"` // ISO 3166-1 alpha-2
+	DistanceMeters float64 `json:"distance_m"`   // from the location to the city's center
+}
+
+// String returns the place's city, region and country, comma-separated; the country code stands
+// in for the country if its name isn't known.
+func (p Place) String() string {
+	country := p.Country
+	if country == "" {
+		country = p.CountryCode
+	}
+	var parts []string
+	for _, part := range []string{p.City, p.Region, country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+type city struct {
+	name        string
+	location    rmloc.Location
+	countryCode string
+	admin1Code  string
+}
+
+// Geocoder finds the nearest city to locations. Cities are indexed in a grid of 1° cells.
+type Geocoder struct {
+	cells       map[[2]int][]city
+	admin1      map[string]string // "US.MI" -> "Michigan"
+	countries   map[string]string // "US" -> "United States"
+	maxDistance float64           // meters
+}
+
+// Load reads the GeoNames files given by cfg.
+func Load(cfg Config) (*Geocoder, error) {
+	g := &Geocoder{
+		cells:       make(map[[2]int][]city),
+		admin1:      make(map[string]string),
+		countries:   make(map[string]string),
+		maxDistance: defaultMaxDistanceKm * 1000,
+	}
+	if cfg.MaxDistanceKm != 0 {
+		g.maxDistance = cfg.MaxDistanceKm * 1000
+	}
+
+	// cities files have 19 tab-separated columns; see "geoname" in the GeoNames readme:
+	err := readTSV(cfg.Cities, 19, func(fields []string) error {
+		lat, latErr := strconv.ParseFloat(fields[4], 64)
+		lon, lonErr := strconv.ParseFloat(fields[5], 64)
+		if latErr != nil || lonErr != nil {
+			return fmt.Errorf("invalid coordinates '%s, %s'", fields[4], fields[5])
+		}
+		c := city{name: fields[1], location: rmloc.Location{Latitude: lat, Longitude: lon}, countryCode: fields[8], admin1Code: fields[10]}
+		cell := cellOf(c.location)
+		g.cells[cell] = append(g.cells[cell], c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Admin1Codes != "" {
+		// code, name, ASCII name, geonameid:
+		err := readTSV(cfg.Admin1Codes, 2, func(fields []string) error {
+			g.admin1[fields[0]] = fields[1]
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.CountryInfo != "" {
+		// ISO, ISO3, ISO-Numeric, fips, Country, ...:
+		err := readTSV(cfg.CountryInfo, 5, func(fields []string) error {
+			g.countries[fields[0]] = fields[4]
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// readTSV calls parse with the fields of each line of the tab-separated file at path, skipping
+// comments. Lines with fewer than minFields fields are an error.
+func readTSV(path string, minFields int, parse func(fields []string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // alternate names can make for long lines
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < minFields {
+			return fmt.Errorf("%s:%d: expected at least %d tab-separated fields, got %d", path, lineNum, minFields, len(fields))
+		}
+		if err := parse(fields); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
+}
+
+func cellOf(loc rmloc.Location) [2]int {
+	return [2]int{int(math.Floor(loc.Latitude)), int(math.Floor(loc.Longitude))}
+}
+
+// Lookup returns the city nearest loc. It reports false if there's no city within the
+// configured maximum distance.
+func (g *Geocoder) Lookup(loc rmloc.Location) (Place, bool) {
+	// search the cells within the maximum distance of loc. A degree of latitude is about 111 km;
+	// a degree of longitude is less, the farther it is from the equator:
+	const metersPerDegree = 111_000
+	latCells := int(math.Ceil(g.maxDistance / metersPerDegree))
+	maxLat := math.Min(math.Abs(loc.Latitude)+float64(latCells)+1, 89)
+	lonCells := min(int(math.Ceil(g.maxDistance/(metersPerDegree*math.Cos(radians(maxLat))))), 180)
+
+	center := cellOf(loc)
+	var nearest *city
+	nearestDistance := g.maxDistance
+	for lat := center[0] - latCells; lat <= center[0]+latCells; lat++ {
+		for dLon := -lonCells; dLon <= lonCells; dLon++ {
+			// wrap around the antimeridian:
+			lon := ((center[1]+dLon+180)%360+360)%360 - 180
+			cell := g.cells[[2]int{lat, lon}]
+			for i := range cell {
+				if d := rmloc.DistanceMeters(loc, cell[i].location); d <= nearestDistance {
+					nearest, nearestDistance = &cell[i], d
+				}
+			}
+		}
+	}
+	if nearest == nil {
+		return Place{}, false
+	}
+
+	return Place{
+		City:           nearest.name,
+		Region:         g.admin1[nearest.countryCode+"."+nearest.admin1Code],
+		RegionCode:     nearest.admin1Code,
+		Country:        g.countries[nearest.countryCode],
+		CountryCode:    nearest.countryCode,
+		DistanceMeters: math.Round(nearestDistance),
+	}, true
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
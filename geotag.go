@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/google/subcommands"
+
+	"xtool/exif"
+	"xtool/geocode"
+	"xtool/geotag"
+	"xtool/rmloc"
+)
+
+const defaultGeotagMaxGap = 5 * time.Minute
+
+type geotagCmd struct {
+	tracks       stringsFlag
+	offset       time.Duration
+	timeZone     string
+	maxGap       time.Duration
+	place        string
+	lat          float64
+	lon          float64
+	alt          float64
+	fillIPTC     bool
+	skipExisting bool
+	dryRun       bool
+	suffix       bool
+	outDir       string
+	verbose      bool
+	verbose2     bool
+	appConfig    AppConfig
+}
+
+func (*geotagCmd) Name() string     { return "geotag" }
+func (*geotagCmd) Synopsis() string { return "Add GPS positions from track logs." }
+
+func (*geotagCmd) Usage() string {
+	return `geotag -track track.gpx [-track track2.kml ...] [-offset DURATION] [-tz ZONE] [-max-gap DURATION] [-skip-existing] [-n] [-s] [-d out_dir] [-v|-vv] file1.jpg [file2.nef ...]
+geotag -place PLACE | -lat LAT -lon LON [-alt ALT] [-skip-existing] [-n] [-s] [-d out_dir] [-v|-vv] file1.jpg [file2.nef ...]
+geotag -fill-iptc [-n] [-s] [-d out_dir] [-v|-vv] file1.jpg [file2.nef ...]:
+  Writes GPS positions into the given photos by matching each photo's DateTimeOriginal against
+  the given GPX, KML, or NMEA track logs. Positions between track points are interpolated, unless
+  the points are more than -max-gap apart. Any existing GPS data is replaced.
+  -offset corrects for the camera's clock: give how far ahead of the true time it was (eg. 1m30s),
+  or a negative duration if it was behind. -tz gives the camera clock's time zone as an IANA name
+  (eg. America/Detroit) or a UTC offset (eg. -04:00); by default each photo's OffsetTimeOriginal
+  is used, or else the local time zone.
+  With -place, writes the location of a place defined in places, including its city, state and
+  country if set, to every photo; with -lat and -lon, writes the given location.
+  With -fill-iptc, writes the city, state and country nearest each photo's existing GPS location
+  to its IPTC and XMP place names, using the GeoNames files given in the geonames config. No
+  network access is needed. Photos without a GPS location, or not near any city, are skipped.
+  With -skip-existing, photos that already have a GPS location are skipped.
+  With -n, prints the position matched for each photo without modifying any files.
+  rmloc removes the GPS data geotag writes.
+`
+}
+
+func (p *geotagCmd) SetFlags(f *flag.FlagSet) {
+	f.Var(&p.tracks, "track", "GPX, KML, or NMEA track log to read. May be given multiple times.")
+	f.DurationVar(&p.offset, "offset", 0, "How far ahead of the true time the camera's clock was (negative if it was behind).")
+	f.StringVar(&p.timeZone, "tz", "", "Time zone of the camera's clock, as an IANA name or UTC offset.")
+	f.DurationVar(&p.maxGap, "max-gap", defaultGeotagMaxGap, "Longest gap between track points to interpolate across.")
+	f.StringVar(&p.place, "place", "", "Write the location of this place, defined in places.")
+	f.Float64Var(&p.lat, "lat", 0, "Write this latitude, in decimal degrees (negative for south). Requires -lon.")
+	f.Float64Var(&p.lon, "lon", 0, "Write this longitude, in decimal degrees (negative for west). Requires -lat.")
+	f.Float64Var(&p.alt, "alt", 0, "With -lat and -lon, write this altitude, in meters.")
+	f.BoolVar(&p.fillIPTC, "fill-iptc", false, "Write the city, state and country nearest each image's GPS location to its IPTC and XMP place names.")
+	f.BoolVar(&p.skipExisting, "skip-existing", false, "Skip images that already have a GPS location.")
+	f.BoolVar(&p.dryRun, "n", false, "Dry run: print the position matched for each image, without modifying it.")
+	f.BoolVar(&p.suffix, "s", false, "Write modified images to new files named with the suffix _geotagged, rather than to the originals.")
+	f.StringVar(&p.outDir, "d", "", "Write modified images to this directory.")
+	f.BoolVar(&p.verbose, "v", false, "Print full exiftool output for each image.")
+	f.BoolVar(&p.verbose2, "vv", false, "Print exiftool commands and full exiftool output.")
+}
+
+func (p *geotagCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if p.verbose2 {
+		p.verbose = true
+	}
+
+	flagsGiven := make(map[string]bool)
+	f.Visit(func(fl *flag.Flag) { flagsGiven[fl.Name] = true })
+	modes := 0
+	for _, mode := range []bool{len(p.tracks) != 0, p.place != "", flagsGiven["lat"] || flagsGiven["lon"], p.fillIPTC} {
+		if mode {
+			modes++
+		}
+	}
+	if len(f.Args()) == 0 || modes != 1 || p.maxGap < 0 || flagsGiven["lat"] != flagsGiven["lon"] || (flagsGiven["alt"] && !flagsGiven["lat"]) || (p.fillIPTC && p.skipExisting) {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	opts := geotag.Options{
+		Output:      exif.Output{Dir: p.outDir, Suffix: p.suffix},
+		ClockOffset: p.offset,
+		MaxGap:      p.maxGap,
+	}
+	if p.timeZone != "" {
+		loc, err := exif.ParseTimeZone(p.timeZone)
+		if err != nil {
+			ErrPrint(ctx, err)
+			return subcommands.ExitUsageError
+		}
+		opts.TimeZone = loc
+	}
+
+	p.appConfig = AppConfigFromCtx(ctx)
+
+	var track geotag.Track
+	var place *geotag.Place
+	var geocoder *geocode.Geocoder
+	if p.fillIPTC {
+		if p.appConfig.GeoNames == nil {
+			ErrPrintln(ctx, "geotag -fill-iptc requires the geonames config")
+			return subcommands.ExitFailure
+		}
+		var err error
+		if geocoder, err = geocode.Load(*p.appConfig.GeoNames); err != nil {
+			ErrPrintf(ctx, "failed to load GeoNames data: %s\n", err)
+			return subcommands.ExitFailure
+		}
+	} else if p.place != "" {
+		configPlace, ok := p.appConfig.Places[p.place]
+		if !ok {
+			ErrPrintf(ctx, "place '%s' is not defined in places\n", p.place)
+			return subcommands.ExitFailure
+		}
+		place = &configPlace
+	} else if flagsGiven["lat"] {
+		place = &geotag.Place{Latitude: p.lat, Longitude: p.lon}
+		if flagsGiven["alt"] {
+			place.Altitude = &p.alt
+		}
+		if err := place.Validate(); err != nil {
+			ErrPrint(ctx, err)
+			return subcommands.ExitUsageError
+		}
+	} else {
+		var err error
+		if track, err = geotag.LoadTracks(p.tracks); err != nil {
+			ErrPrint(ctx, err)
+			return subcommands.ExitFailure
+		}
+		if p.verbose {
+			fmt.Printf("read %d track points from %s to %s\n\n", len(track), track[0].Time.Format(time.RFC3339), track[len(track)-1].Time.Format(time.RFC3339))
+		}
+	}
+
+	et, err := newExiftool(p.appConfig, p.verbose2)
+	if err != nil {
+		ErrPrint(ctx, err)
+		return subcommands.ExitFailure
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer func() { _ = et.Close() }()
+
+	boldWhitePrintf := color.New(color.Bold, color.FgWhite).PrintfFunc()
+	boldRedPrintf := color.New(color.Bold, color.FgRed).PrintfFunc()
+
+	// locate returns the location to write to imgFilename, or a reason to skip it:
+	locate := func(imgFilename string) (geotag.Match, string, error) {
+		if p.skipExisting {
+			if _, hasLocation, err := rmloc.ReadLocation(ctx, et, imgFilename); err != nil {
+				return geotag.Match{}, "", err
+			} else if hasLocation {
+				return geotag.Match{}, "already has a GPS location", nil
+			}
+		}
+		if place != nil {
+			return geotag.Match{File: imgFilename}, "", nil
+		}
+		m, ok, err := geotag.MatchFile(ctx, et, imgFilename, track, opts)
+		if err != nil {
+			return geotag.Match{}, "", err
+		}
+		if !ok {
+			return geotag.Match{}, noMatchReason(m, p.maxGap), nil
+		}
+		return m, "", nil
+	}
+	describe := func(m geotag.Match) string {
+		if place != nil {
+			return describePlace(*place)
+		}
+		return describeMatch(m)
+	}
+	// geocodeFile returns the place nearest imgFilename's GPS location, for -fill-iptc, or a
+	// reason to skip it:
+	geocodeFile := func(imgFilename string) (geocode.Place, string, error) {
+		loc, hasLocation, err := rmloc.ReadLocation(ctx, et, imgFilename)
+		if err != nil {
+			return geocode.Place{}, "", err
+		}
+		if !hasLocation {
+			return geocode.Place{}, "no GPS location", nil
+		}
+		found, ok := geocoder.Lookup(loc)
+		if !ok {
+			return geocode.Place{}, fmt.Sprintf("no city near %.6f, %.6f", loc.Latitude, loc.Longitude), nil
+		}
+		return found, "", nil
+	}
+
+	if p.dryRun {
+		matched := 0
+		for _, imgFilename := range f.Args() {
+			boldWhitePrintf("%s ...\n", imgFilename)
+			var desc, skipReason string
+			var err error
+			if geocoder != nil {
+				var found geocode.Place
+				found, skipReason, err = geocodeFile(imgFilename)
+				desc = describeGeocodedPlace(found)
+			} else {
+				var m geotag.Match
+				m, skipReason, err = locate(imgFilename)
+				desc = describe(m)
+			}
+			if err != nil {
+				fmt.Printf("\t%s\n", err)
+				continue
+			}
+			if skipReason != "" {
+				fmt.Printf("\tskipped: %s\n", skipReason)
+				continue
+			}
+			fmt.Printf("\t%s\n", desc)
+			matched++
+		}
+		boldWhitePrintf("\ngeotag: matched %d of %d images (dry run; no images were modified).\n", matched, len(f.Args()))
+		return subcommands.ExitSuccess
+	}
+
+	successes, failures := ExiftoolProcess(ctx, f.Args(), p.verbose, p.verbose2, func(imgFilename string, startTime time.Time) exif.Result {
+		if geocoder != nil {
+			found, skipReason, err := geocodeFile(imgFilename)
+			if err != nil {
+				return exif.Result{File: imgFilename, Err: err}
+			}
+			if skipReason != "" {
+				return exif.Result{File: imgFilename, SkipReason: skipReason}
+			}
+			fmt.Println(describeGeocodedPlace(found))
+			return geotag.Fill(ctx, et, imgFilename, found, opts.Output, startTime)
+		}
+
+		m, skipReason, err := locate(imgFilename)
+		if err != nil {
+			return exif.Result{File: imgFilename, Err: err}
+		}
+		if skipReason != "" {
+			return exif.Result{File: imgFilename, SkipReason: skipReason}
+		}
+		fmt.Println(describe(m))
+		if place != nil {
+			return geotag.Stamp(ctx, et, imgFilename, *place, opts.Output, startTime)
+		}
+		return geotag.Geotag(ctx, et, m, opts.Output, startTime)
+	})
+
+	boldWhitePrintf("\ngeotag: successfully processed %d images.\n", len(successes))
+	if skipped := len(f.Args()) - len(successes) - len(failures); skipped > 0 {
+		boldWhitePrintf("geotag: skipped %d images.\n", skipped)
+	}
+
+	if len(failures) != 0 {
+		boldRedPrintf("Errors:\n")
+		for filename, err := range failures {
+			fmt.Printf("- %s %s\n", color.MagentaString("%s:", filename), err)
+		}
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
+
+func describeMatch(m geotag.Match) string {
+	desc := fmt.Sprintf("%s %.6f, %.6f", color.MagentaString("%s:", m.Time.Format(time.RFC3339)), m.Fix.Latitude, m.Fix.Longitude)
+	if m.Fix.Elevation != nil {
+		desc += fmt.Sprintf(" (%.0f m)", *m.Fix.Elevation)
+	}
+	if m.Fix.Interpolated {
+		desc += fmt.Sprintf(", interpolated between track points %s apart", m.Fix.Gap)
+	} else if m.Fix.Gap > 0 {
+		desc += fmt.Sprintf(", from the track point %s away", m.Fix.Gap)
+	}
+	return desc
+}
+
+func describePlace(place geotag.Place) string {
+	desc := fmt.Sprintf("%.6f, %.6f", place.Latitude, place.Longitude)
+	if place.Altitude != nil {
+		desc += fmt.Sprintf(" (%.0f m)", *place.Altitude)
+	}
+	var names []string
+	for _, name := range []string{place.City, place.State, place.Country} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) != 0 {
+		desc += ", " + strings.Join(names, ", ")
+	}
+	return desc
+}
+
+func describeGeocodedPlace(place geocode.Place) string {
+	return fmt.Sprintf("%s (%.1f km from its center)", place, place.DistanceMeters/1000)
+}
+
+func noMatchReason(m geotag.Match, maxGap time.Duration) string {
+	return fmt.Sprintf("no track position within %s (-max-gap) of %s", maxGap, m.Time.Format(time.RFC3339))
+}
+
+// stringsFlag is a flag.Value collecting each value given for a flag that may be repeated.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
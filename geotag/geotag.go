@@ -0,0 +1,117 @@
+// Package geotag writes GPS positions into images, by matching the time each image was made
+// against track logs.
+package geotag
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"xtool/exif"
+)
+
+// Options control how image times are matched to a track, and how matched positions are written.
+type Options struct {
+	Output      exif.Output
+	ClockOffset time.Duration  // how far ahead of the true time the camera's clock was (negative if it was behind)
+	TimeZone    *time.Location // the time zone of the camera's clock; if nil, each image's OffsetTimeOriginal is used, or else the local time zone
+	MaxGap      time.Duration  // the longest gap between track points a position may be interpolated across
+}
+
+// Match is the position found for an image.
+type Match struct {
+	File string
+	Time time.Time // when the image was made, corrected for the camera's clock offset
+	Fix  Fix
+}
+
+// ReadTime reads when file was made, from its DateTimeOriginal, corrected for the camera's
+// clock offset and time zone.
+func ReadTime(ctx context.Context, et *exif.Exiftool, file string, opts Options) (time.Time, error) {
+	result, err := et.ReadJSON(ctx, []string{"-DateTimeOriginal", "-OffsetTimeOriginal"}, file)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(result) != 1 {
+		return time.Time{}, fmt.Errorf("invalid exiftool output: expected 1 item, got %d", len(result))
+	}
+	dateTime, ok := result[0].String("DateTimeOriginal")
+	if !ok {
+		return time.Time{}, fmt.Errorf("no DateTimeOriginal")
+	}
+
+	loc := opts.TimeZone
+	if loc == nil {
+		loc = time.Local
+		if offset, ok := result[0].String("OffsetTimeOriginal"); ok && offset != "" {
+			if loc, err = exif.ParseOffset(offset); err != nil {
+				return time.Time{}, fmt.Errorf("invalid OffsetTimeOriginal: %w", err)
+			}
+		}
+	}
+	t, err := exif.ParseDateTime(dateTime, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid DateTimeOriginal: %w", err)
+	}
+	return t.Add(-opts.ClockOffset), nil
+}
+
+// MatchFile finds file's position in track. It reports false if the track has no position
+// for the time file was made.
+func MatchFile(ctx context.Context, et *exif.Exiftool, file string, track Track, opts Options) (Match, bool, error) {
+	t, err := ReadTime(ctx, et, file, opts)
+	if err != nil {
+		return Match{}, false, err
+	}
+	fix, ok := track.Locate(t, opts.MaxGap)
+	fix.Time = t
+	return Match{File: file, Time: t, Fix: fix}, ok, nil
+}
+
+// Args returns the exiftool arguments that write p as a file's location, replacing all its
+// GPS tags. The GPS date & time are written only if p.Time is set.
+func Args(p Point, out exif.Output) []string {
+	latRef, lonRef := "N", "E"
+	if p.Latitude < 0 {
+		latRef = "S"
+	}
+	if p.Longitude < 0 {
+		lonRef = "W"
+	}
+	exiftoolArgs := []string{
+		"-gps*=",
+		"-" + exif.TagLocationPrecision + "=",
+		// EXIF stores the coordinates unsigned, with a Ref; XMP stores them signed:
+		"-GPSLatitude=" + formatFloat(p.Latitude, 7),
+		"-GPSLatitudeRef=" + latRef,
+		"-GPSLongitude=" + formatFloat(p.Longitude, 7),
+		"-GPSLongitudeRef=" + lonRef,
+	}
+	if !p.Time.IsZero() {
+		utc := p.Time.UTC()
+		exiftoolArgs = append(exiftoolArgs, "-GPSDateStamp="+utc.Format("2006:01:02"), "-GPSTimeStamp="+utc.Format("15:04:05"))
+	}
+	if p.Elevation != nil {
+		altRef := "0" // above sea level
+		if *p.Elevation < 0 {
+			altRef = "1"
+		}
+		exiftoolArgs = append(exiftoolArgs,
+			"-GPSAltitude="+formatFloat(math.Abs(*p.Elevation), 1),
+			"-GPSAltitudeRef#="+altRef,
+		)
+	}
+
+	return append(exiftoolArgs, out.Args("geotagged")...)
+}
+
+func formatFloat(f float64, prec int) string {
+	return strconv.FormatFloat(f, 'f', prec, 64)
+}
+
+// Geotag writes m's position into its file. See exif.Exiftool.ProcessFile for how backups are handled.
+func Geotag(ctx context.Context, et *exif.Exiftool, m Match, out exif.Output, startTime time.Time) exif.Result {
+	return et.ProcessFile(ctx, Args(m.Fix.Point, out), m.File, startTime)
+}
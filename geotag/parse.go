@@ -0,0 +1,238 @@
+package geotag
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func parseGPX(path string) ([]Point, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer func() { _ = f.Close() }()
+
+	var gpx struct {
+		Tracks []struct {
+			Segments []struct {
+				Points []gpxPoint `xml:"trkpt"`
+			} `xml:"trkseg"`
+		} `xml:"trk"`
+		Waypoints []gpxPoint `xml:"wpt"`
+	}
+	if err := xml.NewDecoder(f).Decode(&gpx); err != nil {
+		return nil, err
+	}
+
+	var points []Point
+	for _, trk := range gpx.Tracks {
+		for _, seg := range trk.Segments {
+			for _, pt := range seg.Points {
+				if p, ok := pt.point(); ok {
+					points = append(points, p)
+				}
+			}
+		}
+	}
+	for _, pt := range gpx.Waypoints {
+		if p, ok := pt.point(); ok {
+			points = append(points, p)
+		}
+	}
+	return points, nil
+}
+
+type gpxPoint struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Ele  *float64 `xml:"ele"`
+	Time string   `xml:"time"`
+}
+
+func (pt gpxPoint) point() (Point, bool) {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(pt.Time))
+	if err != nil {
+		return Point{}, false
+	}
+	return Point{Time: t, Latitude: pt.Lat, Longitude: pt.Lon, Elevation: pt.Ele}, true
+}
+
+// parseKML reads the points of gx:Track elements, and of Placemarks with a TimeStamp and a Point.
+func parseKML(path string) ([]Point, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer func() { _ = f.Close() }()
+
+	var points []Point
+	var inTrack bool
+	var trackWhens, trackCoords []string
+	var placemarkWhen, placemarkCoords string
+
+	dec := xml.NewDecoder(f)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "Track":
+				inTrack = true
+				trackWhens, trackCoords = nil, nil
+			case "Placemark":
+				placemarkWhen, placemarkCoords = "", ""
+			case "when", "coord", "coordinates":
+				var text string
+				if err := dec.DecodeElement(&text, &el); err != nil {
+					return nil, err
+				}
+				switch {
+				case el.Name.Local == "when" && inTrack:
+					trackWhens = append(trackWhens, text)
+				case el.Name.Local == "when":
+					placemarkWhen = text
+				case el.Name.Local == "coord" && inTrack:
+					trackCoords = append(trackCoords, text)
+				case el.Name.Local == "coordinates" && !inTrack:
+					placemarkCoords = text
+				}
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "Track":
+				inTrack = false
+				for i := 0; i < len(trackWhens) && i < len(trackCoords); i++ {
+					// gx:coord is "lon lat [ele]":
+					if p, ok := kmlPoint(trackWhens[i], strings.Fields(trackCoords[i])); ok {
+						points = append(points, p)
+					}
+				}
+			case "Placemark":
+				// coordinates is "lon,lat[,ele]":
+				if p, ok := kmlPoint(placemarkWhen, strings.Split(strings.TrimSpace(placemarkCoords), ",")); ok {
+					points = append(points, p)
+				}
+			}
+		}
+	}
+	return points, nil
+}
+
+func kmlPoint(when string, coords []string) (Point, bool) {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(when))
+	if err != nil || len(coords) < 2 {
+		return Point{}, false
+	}
+	lon, err1 := strconv.ParseFloat(strings.TrimSpace(coords[0]), 64)
+	lat, err2 := strconv.ParseFloat(strings.TrimSpace(coords[1]), 64)
+	if err1 != nil || err2 != nil {
+		return Point{}, false
+	}
+	p := Point{Time: t, Latitude: lat, Longitude: lon}
+	if len(coords) > 2 {
+		if ele, err := strconv.ParseFloat(strings.TrimSpace(coords[2]), 64); err == nil {
+			p.Elevation = &ele
+		}
+	}
+	return p, true
+}
+
+// parseNMEA reads positions from RMC sentences, and elevations from the GGA sentences that
+// accompany them.
+func parseNMEA(path string) ([]Point, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer func() { _ = f.Close() }()
+
+	var points []Point
+	var lastGGATime string
+	var lastGGAEle *float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, '*'); i != -1 {
+			line = line[:i] // strip the checksum
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) < 10 || !strings.HasPrefix(fields[0], "$") || len(fields[0]) != 6 {
+			continue
+		}
+
+		switch fields[0][3:] {
+		case "GGA":
+			lastGGATime = fields[1]
+			lastGGAEle = nil
+			if ele, err := strconv.ParseFloat(fields[9], 64); err == nil {
+				lastGGAEle = &ele
+			}
+			if len(points) != 0 && points[len(points)-1].Elevation == nil && nmeaTimeMatches(points[len(points)-1], fields[1]) {
+				points[len(points)-1].Elevation = lastGGAEle
+			}
+		case "RMC":
+			if fields[2] != "A" {
+				continue // no fix
+			}
+			t, err := time.Parse("020106150405", fields[9]+fields[1])
+			if err != nil {
+				continue
+			}
+			lat, err1 := nmeaDegrees(fields[3], fields[4])
+			lon, err2 := nmeaDegrees(fields[5], fields[6])
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			p := Point{Time: t, Latitude: lat, Longitude: lon}
+			if lastGGATime == fields[1] {
+				p.Elevation = lastGGAEle
+			}
+			points = append(points, p)
+		}
+	}
+	return points, scanner.Err()
+}
+
+func nmeaTimeMatches(p Point, hhmmss string) bool {
+	return strings.HasPrefix(hhmmss, p.Time.Format("150405"))
+}
+
+// nmeaDegrees converts an NMEA (d)ddmm.mmmm coordinate and its hemisphere to signed decimal degrees.
+func nmeaDegrees(value, hemisphere string) (float64, error) {
+	dot := strings.IndexByte(value, '.')
+	if dot == -1 {
+		dot = len(value)
+	}
+	if dot < 3 {
+		return 0, fmt.Errorf("invalid NMEA coordinate '%s'", value)
+	}
+	degrees, err := strconv.ParseFloat(value[:dot-2], 64)
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.ParseFloat(value[dot-2:], 64)
+	if err != nil {
+		return 0, err
+	}
+	degrees += minutes / 60
+	if hemisphere == "S" || hemisphere == "W" {
+		degrees = -degrees
+	}
+	return degrees, nil
+}
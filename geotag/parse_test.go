@@ -0,0 +1,107 @@
+package geotag
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func ele(meters float64) *float64 {
+	return &meters
+}
+
+func at(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// checkPoints compares points to want, allowing for rounding in the conversion to decimal degrees.
+func checkPoints(t *testing.T, points []Point, want []Point) {
+	t.Helper()
+	if len(points) != len(want) {
+		t.Fatalf("got %d points; want %d: %+v", len(points), len(want), points)
+	}
+	for i, p := range points {
+		w := want[i]
+		if !p.Time.Equal(w.Time) ||
+			math.Abs(p.Latitude-w.Latitude) > 1e-6 || math.Abs(p.Longitude-w.Longitude) > 1e-6 ||
+			(p.Elevation == nil) != (w.Elevation == nil) ||
+			(p.Elevation != nil && math.Abs(*p.Elevation-*w.Elevation) > 1e-6) {
+			t.Errorf("point %d = %s; want %s", i, describePoint(p), describePoint(w))
+		}
+	}
+}
+
+func describePoint(p Point) string {
+	desc := p.Time.UTC().Format(time.RFC3339) + " " + formatFloat(p.Latitude, 6) + "," + formatFloat(p.Longitude, 6)
+	if p.Elevation != nil {
+		desc += " " + formatFloat(*p.Elevation, 1) + "m"
+	}
+	return desc
+}
+
+func TestParseGPX(t *testing.T) {
+	points, err := parseGPX(filepath.Join("testdata", "track.gpx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// track points without a time are skipped; waypoints with one follow the track points:
+	checkPoints(t, points, []Point{
+		{Time: at("2024-06-01T14:00:00Z"), Latitude: 42.2808, Longitude: -83.7430, Elevation: ele(256.5)},
+		{Time: at("2024-06-01T14:01:00Z"), Latitude: 42.2810, Longitude: -83.7420},
+		{Time: at("2024-06-01T14:05:00Z"), Latitude: 42.2830, Longitude: -83.7390, Elevation: ele(261)},
+		{Time: at("2024-06-01T15:30:00Z"), Latitude: 42.2900, Longitude: -83.7200},
+	})
+}
+
+func TestParseKML(t *testing.T) {
+	points, err := parseKML(filepath.Join("testdata", "track.kml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the track's unmatched third when, and the Placemark without a TimeStamp, are skipped:
+	checkPoints(t, points, []Point{
+		{Time: at("2024-06-01T14:00:00Z"), Latitude: 42.2808, Longitude: -83.7430, Elevation: ele(256.5)},
+		{Time: at("2024-06-01T14:01:00Z"), Latitude: 42.2810, Longitude: -83.7420},
+		{Time: at("2024-06-01T16:00:00Z"), Latitude: 42.3314, Longitude: -83.0458, Elevation: ele(180)},
+	})
+}
+
+func TestParseNMEA(t *testing.T) {
+	points, err := parseNMEA(filepath.Join("testdata", "track.nmea"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the RMC sentence without a fix, and other sentences, are skipped; elevations come from GGA
+	// sentences with the same time, before or after the RMC sentence:
+	checkPoints(t, points, []Point{
+		{Time: at("1994-03-23T12:35:19Z"), Latitude: 48 + 7.038/60, Longitude: 11 + 31.0/60, Elevation: ele(545.4)},
+		{Time: at("1994-03-24T12:35:21Z"), Latitude: -(33 + 52.128/60), Longitude: 151 + 12.558/60, Elevation: ele(12.5)},
+		{Time: at("1994-03-24T12:35:22Z"), Latitude: -(33 + 52.130/60), Longitude: 151 + 12.560/60},
+	})
+}
+
+func TestNMEADegrees(t *testing.T) {
+	for _, tc := range []struct {
+		value, hemisphere string
+		want              float64
+		wantErr           bool
+	}{
+		{"4807.038", "N", 48 + 7.038/60, false},
+		{"01131.000", "E", 11 + 31.0/60, false},
+		{"12030.5", "W", -(120 + 30.5/60), false},
+		{"3352", "S", -(33 + 52.0/60), false},
+		{"07.5", "N", 0, true},
+		{"", "N", 0, true},
+		{"ab07.5", "N", 0, true},
+	} {
+		got, err := nmeaDegrees(tc.value, tc.hemisphere)
+		if (err != nil) != tc.wantErr || math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("nmeaDegrees(%q, %q) = %v, %v; want %v (error: %v)", tc.value, tc.hemisphere, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
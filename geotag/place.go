@@ -0,0 +1,79 @@
+package geotag
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"xtool/exif"
+	"xtool/geocode"
+)
+
+// Place is a fixed location, such as a studio, for geotagging files made without a GPS, such as
+// scans or photos from vintage cameras.
+type Place struct {
+	Latitude  float64  `json:"lat"`
+	Longitude float64  `json:"lon"`
+	Altitude  *float64 `json:"alt,omitempty"` // meters above sea level
+	City      string   `json:"city,omitempty"`
+	State     string   `json:"state,omitempty"`
+	Country   string   `json:"country,omitempty"`
+}
+
+func (p Place) Validate() error {
+	if p.Latitude < -90 || p.Latitude > 90 {
+		return fmt.Errorf("latitude %v is out of range", p.Latitude)
+	}
+	if p.Longitude < -180 || p.Longitude > 180 {
+		return fmt.Errorf("longitude %v is out of range", p.Longitude)
+	}
+	return nil
+}
+
+// PlaceArgs returns the exiftool arguments that write place as a file's location, replacing all
+// its GPS tags. The place's city, state and country, if set, are written to IPTC and XMP.
+func PlaceArgs(place Place, out exif.Output) []string {
+	exiftoolArgs := Args(Point{Latitude: place.Latitude, Longitude: place.Longitude, Elevation: place.Altitude}, out)
+	return append(exiftoolArgs, placeNameArgs(place.City, place.State, place.Country)...)
+}
+
+// placeNameArgs returns the exiftool arguments that write the given city, state and country, if
+// set, to IPTC and XMP. If any are written, IPTC is marked as UTF-8, so names like "Zürich" read
+// back correctly; exiftool otherwise writes IPTC strings as Latin-1 with no CodedCharacterSet.
+func placeNameArgs(city, state, country string) []string {
+	var exiftoolArgs []string
+	for _, tag := range []struct{ value, iptcTag, xmpTag string }{
+		{city, "IPTC:City", "XMP-photoshop:City"},
+		{state, "IPTC:Province-State", "XMP-photoshop:State"},
+		{country, "IPTC:Country-PrimaryLocationName", "XMP-photoshop:Country"},
+	} {
+		if tag.value != "" {
+			exiftoolArgs = append(exiftoolArgs, "-"+tag.iptcTag+"="+tag.value, "-"+tag.xmpTag+"="+tag.value)
+		}
+	}
+	if len(exiftoolArgs) == 0 {
+		return nil
+	}
+	return append([]string{"-IPTC:CodedCharacterSet=UTF8"}, exiftoolArgs...)
+}
+
+// FillArgs returns the exiftool arguments that write place, found by reverse geocoding a file's
+// GPS location, to its IPTC and XMP city, state and country. The GPS tags are left unchanged.
+func FillArgs(place geocode.Place, out exif.Output) []string {
+	exiftoolArgs := placeNameArgs(place.City, place.Region, place.Country)
+	if place.CountryCode != "" {
+		exiftoolArgs = append(exiftoolArgs, "-IPTC:Country-PrimaryLocationCode="+place.CountryCode, "-XMP-iptcCore:CountryCode="+place.CountryCode)
+	}
+	return append(exiftoolArgs, out.Args("geotagged")...)
+}
+
+// Fill writes place, found by reverse geocoding file's GPS location, to file's IPTC and XMP place
+// names. See exif.Exiftool.ProcessFile for how backups are handled.
+func Fill(ctx context.Context, et *exif.Exiftool, file string, place geocode.Place, out exif.Output, startTime time.Time) exif.Result {
+	return et.ProcessFile(ctx, FillArgs(place, out), file, startTime)
+}
+
+// Stamp writes place as file's location. See exif.Exiftool.ProcessFile for how backups are handled.
+func Stamp(ctx context.Context, et *exif.Exiftool, file string, place Place, out exif.Output, startTime time.Time) exif.Result {
+	return et.ProcessFile(ctx, PlaceArgs(place, out), file, startTime)
+}
@@ -0,0 +1,50 @@
+package geotag
+
+import (
+	"slices"
+	"testing"
+
+	"xtool/exif"
+	"xtool/geocode"
+)
+
+func TestFillArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		place geocode.Place
+		want  []string
+	}{
+		{
+			name:  "all names",
+			place: geocode.Place{City: "Zürich", Region: "Zurich", RegionCode: "25", Country: "Switzerland", CountryCode: "CH"},
+			want: []string{
+				"-IPTC:CodedCharacterSet=UTF8",
+				"-IPTC:City=Zürich", "-XMP-photoshop:City=Zürich",
+				"-IPTC:Province-State=Zurich", "-XMP-photoshop:State=Zurich",
+				"-IPTC:Country-PrimaryLocationName=Switzerland", "-XMP-photoshop:Country=Switzerland",
+				"-IPTC:Country-PrimaryLocationCode=CH", "-XMP-iptcCore:CountryCode=CH",
+			},
+		},
+		{
+			name:  "codes only, for region and country",
+			place: geocode.Place{City: "Ann Arbor", RegionCode: "MI", CountryCode: "US"},
+			want: []string{
+				"-IPTC:CodedCharacterSet=UTF8",
+				"-IPTC:City=Ann Arbor", "-XMP-photoshop:City=Ann Arbor",
+				"-IPTC:Country-PrimaryLocationCode=US", "-XMP-iptcCore:CountryCode=US",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := FillArgs(tc.place, exif.Output{}); !slices.Equal(got, tc.want) {
+				t.Errorf("FillArgs() = %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPlaceNameArgsWithoutNames(t *testing.T) {
+	if got := placeNameArgs("", "", ""); len(got) != 0 {
+		t.Errorf("placeNameArgs() = %q; want no args", got)
+	}
+}
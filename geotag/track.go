@@ -0,0 +1,93 @@
+package geotag
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Point is a position recorded in a track log.
+type Point struct {
+	Time      time.Time
+	Latitude  float64  // signed decimal degrees
+	Longitude float64  // signed decimal degrees
+	Elevation *float64 // meters above sea level; nil if the track doesn't record elevation
+}
+
+// Track is a series of points, ordered by time.
+type Track []Point
+
+// LoadTracks reads and merges the given track log files. GPX (.gpx), KML (.kml), and NMEA
+// (.nmea, .log, .txt) files are supported.
+func LoadTracks(paths []string) (Track, error) {
+	var track Track
+	for _, path := range paths {
+		var points []Point
+		var err error
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".gpx":
+			points, err = parseGPX(path)
+		case ".kml":
+			points, err = parseKML(path)
+		case ".nmea", ".log", ".txt":
+			points, err = parseNMEA(path)
+		default:
+			return nil, fmt.Errorf("'%s' is not a GPX, KML, or NMEA track log", path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read track log '%s': %w", path, err)
+		}
+		if len(points) == 0 {
+			return nil, fmt.Errorf("track log '%s' has no timestamped points", path)
+		}
+		track = append(track, points...)
+	}
+	sort.SliceStable(track, func(i, j int) bool { return track[i].Time.Before(track[j].Time) })
+	return track, nil
+}
+
+// Fix is the position Locate found for a time.
+type Fix struct {
+	Point
+	Interpolated bool          // whether the position was interpolated between two track points
+	Gap          time.Duration // the time between the track points the position was interpolated between, or to the nearest point
+}
+
+// Locate returns the position at t. Between two points no more than maxGap apart, the position
+// is interpolated linearly; within maxGap before the start or after the end of the track, the
+// first or last point is used.
+func (tr Track) Locate(t time.Time, maxGap time.Duration) (Fix, bool) {
+	if len(tr) == 0 {
+		return Fix{}, false
+	}
+	i := sort.Search(len(tr), func(i int) bool { return !tr[i].Time.Before(t) })
+	switch {
+	case i < len(tr) && tr[i].Time.Equal(t):
+		return Fix{Point: tr[i]}, true
+	case i == 0:
+		gap := tr[0].Time.Sub(t)
+		return Fix{Point: tr[0], Gap: gap}, gap <= maxGap
+	case i == len(tr):
+		gap := t.Sub(tr[len(tr)-1].Time)
+		return Fix{Point: tr[len(tr)-1], Gap: gap}, gap <= maxGap
+	}
+
+	before, after := tr[i-1], tr[i]
+	gap := after.Time.Sub(before.Time)
+	if gap > maxGap {
+		return Fix{Gap: gap}, false
+	}
+	frac := float64(t.Sub(before.Time)) / float64(gap)
+	p := Point{
+		Time:      t,
+		Latitude:  before.Latitude + (after.Latitude-before.Latitude)*frac,
+		Longitude: before.Longitude + (after.Longitude-before.Longitude)*frac,
+	}
+	if before.Elevation != nil && after.Elevation != nil {
+		ele := *before.Elevation + (*after.Elevation-*before.Elevation)*frac
+		p.Elevation = &ele
+	}
+	return Fix{Point: p, Interpolated: true, Gap: gap}, true
+}
@@ -0,0 +1,116 @@
+package geotag
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadTracks(t *testing.T) {
+	track, err := LoadTracks([]string{filepath.Join("testdata", "track.kml"), filepath.Join("testdata", "track.nmea")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(track) != 6 {
+		t.Fatalf("got %d points; want 6", len(track))
+	}
+	for i := 1; i < len(track); i++ {
+		if track[i].Time.Before(track[i-1].Time) {
+			t.Errorf("point %d (%s) is before point %d (%s)", i, track[i].Time, i-1, track[i-1].Time)
+		}
+	}
+
+	if _, err := LoadTracks([]string{filepath.Join("testdata", "track.csv")}); err == nil {
+		t.Error("LoadTracks() with an unsupported format: want an error")
+	}
+}
+
+func TestLocate(t *testing.T) {
+	start := at("2024-06-01T14:00:00Z")
+	track := Track{
+		{Time: start, Latitude: 42.0, Longitude: -83.0, Elevation: ele(200)},
+		{Time: start.Add(time.Minute), Latitude: 42.1, Longitude: -83.2, Elevation: ele(300)},
+		{Time: start.Add(2 * time.Minute), Latitude: 42.2, Longitude: -83.4},
+		{Time: start.Add(12 * time.Minute), Latitude: 42.3, Longitude: -83.6},
+	}
+	maxGap := 2 * time.Minute
+
+	for _, tc := range []struct {
+		name   string
+		t      time.Time
+		want   Fix
+		wantOK bool
+	}{
+		{
+			name:   "at a point",
+			t:      start.Add(time.Minute),
+			want:   Fix{Point: track[1]},
+			wantOK: true,
+		},
+		{
+			name: "interpolated",
+			t:    start.Add(15 * time.Second),
+			want: Fix{
+				Point:        Point{Time: start.Add(15 * time.Second), Latitude: 42.025, Longitude: -83.05, Elevation: ele(225)},
+				Interpolated: true,
+				Gap:          time.Minute,
+			},
+			wantOK: true,
+		},
+		{
+			name: "interpolated, without elevation on one side",
+			t:    start.Add(90 * time.Second),
+			want: Fix{
+				Point:        Point{Time: start.Add(90 * time.Second), Latitude: 42.15, Longitude: -83.3},
+				Interpolated: true,
+				Gap:          time.Minute,
+			},
+			wantOK: true,
+		},
+		{
+			name:   "between points further apart than maxGap",
+			t:      start.Add(5 * time.Minute),
+			want:   Fix{Gap: 10 * time.Minute},
+			wantOK: false,
+		},
+		{
+			name:   "shortly before the start",
+			t:      start.Add(-time.Minute),
+			want:   Fix{Point: track[0], Gap: time.Minute},
+			wantOK: true,
+		},
+		{
+			name:   "long before the start",
+			t:      start.Add(-3 * time.Minute),
+			want:   Fix{Point: track[0], Gap: 3 * time.Minute},
+			wantOK: false,
+		},
+		{
+			name:   "at maxGap after the end",
+			t:      start.Add(14 * time.Minute),
+			want:   Fix{Point: track[3], Gap: 2 * time.Minute},
+			wantOK: true,
+		},
+		{
+			name:   "long after the end",
+			t:      start.Add(15 * time.Minute),
+			want:   Fix{Point: track[3], Gap: 3 * time.Minute},
+			wantOK: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fix, ok := track.Locate(tc.t, maxGap)
+			if ok != tc.wantOK {
+				t.Errorf("Locate() ok = %v; want %v", ok, tc.wantOK)
+			}
+			if fix.Interpolated != tc.want.Interpolated || fix.Gap != tc.want.Gap {
+				t.Errorf("Locate() = interpolated %v, gap %s; want interpolated %v, gap %s", fix.Interpolated, fix.Gap, tc.want.Interpolated, tc.want.Gap)
+			}
+			checkPoints(t, []Point{fix.Point}, []Point{tc.want.Point})
+		})
+	}
+
+	if _, ok := Track(nil).Locate(start, maxGap); ok {
+		t.Error("Locate() on an empty track: want no fix")
+	}
+}
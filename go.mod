@@ -8,6 +8,7 @@ require (
 	github.com/codeclysm/extract/v4 v4.0.0
 	github.com/fatih/color v1.17.0
 	github.com/google/subcommands v1.2.0
+	golang.org/x/crypto v0.28.0
 )
 
 require (
@@ -5,26 +5,93 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"sort"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/google/subcommands"
+
+	"xtool/camswap"
+	"xtool/geocode"
+	"xtool/inspect"
+	"xtool/rmloc"
+)
+
+// inspect's exit codes for its -fail-* assertions. If several assertions fail, the first listed
+// here is returned.
+const (
+	exitInspectError      subcommands.ExitStatus = 3 // -fail-on-error
+	exitInspectGPS        subcommands.ExitStatus = 4 // -fail-if-gps
+	exitInspectSwapped    subcommands.ExitStatus = 5 // -fail-if-swapped
+	exitInspectNotSwapped subcommands.ExitStatus = 6 // -fail-if-not-swapped
 )
 
 type inspectCmd struct {
-	location  bool
-	swap      bool
-	appConfig AppConfig
+	location         bool
+	swap             bool
+	previews         bool
+	extractDir       string
+	format           string
+	summary          bool
+	exportPath       string
+	detail           bool
+	failOnError      bool
+	failIfGPS        bool
+	failIfSwapped    bool
+	failIfNotSwapped bool
+	appConfig        AppConfig
+}
+
+// inspectAssertion is one of inspect's -fail-* flags, and the files that failed it.
+type inspectAssertion struct {
+	enabled *bool
+	flag    string
+	problem string
+	code    subcommands.ExitStatus
+	failed  func(inspect.Report) bool
+	files   []string
 }
 
 func (*inspectCmd) Name() string     { return "inspect" }
 func (*inspectCmd) Synopsis() string { return "Inspect image files for GPS or camera-swap data." }
 
 func (*inspectCmd) Usage() string {
-	return `inspect -l|-s file1.jpg [file2.nef ...]:
-  Inspects the given image files for GPS or camera-swap data.
+	return `inspect [-l] [-s] [-previews [-extract DIR]] [-o text|json|csv|table] [-summary [-detail]] [-export places.geojson|.gpx|.kml] [-fail-on-error] [-fail-if-gps] [-fail-if-swapped|-fail-if-not-swapped] file1.jpg [file2.nef ...]:
+  Inspects the given image files for GPS or camera-swap data; with neither -l nor -s (nor
+  -previews), both.
+  -previews lists every image embedded in each file (ThumbnailImage, PreviewImage, JpgFromRaw,
+  OtherImage) with its dimensions and whether it carries its own EXIF or GPS metadata. Embedded
+  images can leak the uncropped or unedited image, or a location removed from the file itself;
+  rmloc -deep cleans them. With -extract, they're also saved to the given directory, named like
+  photo_PreviewImage.jpg (or photo_PreviewImage-2.jpg, etc., rather than overwriting a file).
+  The -fail-* flags make inspect usable as a check before publishing: if any file fails one,
+  inspect prints a summary of the offending files and exits with a distinct status:
+    -fail-on-error:       3 (a file couldn't be read)
+    -fail-if-gps:         4 (a file has GPS data, including in an embedded image with -previews)
+    -fail-if-swapped:     5 (a file has been camswapped)
+    -fail-if-not-swapped: 6 (a file hasn't been camswapped)
+  If several fail, the first status listed is used.
+  -o json prints a JSON array with an object per file: {"file", "error", "capture_time",
+  "camera", "swap", "location"}, where "swap" is {"swapped", "model", "original_model",
+  "swapped_tags", "current", "originals", "history"} and "location" is {"has_gps",
+  "has_place_names", "latitude", "longitude", "coarsened_precision", "stash", "privacy_zone",
+  "place", "tags"}, or null if not inspected; with -previews, "previews" is an array of {"tag",
+  "width", "height", "bytes", "has_exif", "has_gps", "extracted"}, and "preview_error" is set if
+  they couldn't be inspected.
+  -o csv prints the same fields as columns, with a header row; -o table prints a summary table.
+  Fields may be added in future versions, but existing fields won't be renamed or removed.
+  -summary prints aggregate statistics instead of each file's report: how many files are
+  camswapped (by original and swapped model), have GPS data, or couldn't be read, and the
+  distinct camera models. With -detail, each file's report is printed too. With -o json, the
+  output is an object: {"summary", "files"}, where "files" is null without -detail. -summary
+  can't be used with -o csv.
+  -export writes the GPS position of each geotagged file to a GeoJSON, GPX, or KML file (by its
+  extension), with the file's name, capture time, and camera, for reviewing on a map. It implies -l.
+  If the geonames config is set, each GPS location is reverse geocoded offline to the nearest
+  city, shown as its place: {"city", "region", "country", "country_code", "distance_m"}.
 `
 }
 
@@ -32,121 +99,311 @@ func (p *inspectCmd) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&p.location, "l", false, "Inspect image files for location/GPS data.")
 	f.BoolVar(&p.location, "g", false, "Inspect image files for location/GPS data (alias for -l).")
 	f.BoolVar(&p.swap, "s", false, "Inspect image files for camera-swap data.")
+	f.BoolVar(&p.previews, "previews", false, "List the preview images and thumbnails embedded in image files.")
+	f.StringVar(&p.extractDir, "extract", "", "With -previews, extract embedded images to this directory.")
+	f.StringVar(&p.format, "o", "text", "Output format: text, "+strings.Join(inspect.Formats, ", ")+".")
+	f.BoolVar(&p.summary, "summary", false, "Print aggregate statistics rather than each file's report.")
+	f.BoolVar(&p.detail, "detail", false, "With -summary, print each file's report too.")
+	f.StringVar(&p.exportPath, "export", "", "Write geotagged files' positions to this GeoJSON, GPX, or KML file.")
+	f.BoolVar(&p.failOnError, "fail-on-error", false, "Exit with status 3 if any file can't be read.")
+	f.BoolVar(&p.failIfGPS, "fail-if-gps", false, "Exit with status 4 if any file has GPS data.")
+	f.BoolVar(&p.failIfSwapped, "fail-if-swapped", false, "Exit with status 5 if any file has been camswapped.")
+	f.BoolVar(&p.failIfNotSwapped, "fail-if-not-swapped", false, "Exit with status 6 if any file hasn't been camswapped.")
 }
 
 func (p *inspectCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	if len(f.Args()) == 0 {
+	if len(f.Args()) == 0 || (p.format != "text" && !slices.Contains(inspect.Formats, p.format)) || (p.failIfSwapped && p.failIfNotSwapped) ||
+		(p.summary && p.format == "csv") || (p.detail && !p.summary) || (p.extractDir != "" && !p.previews) {
 		f.Usage()
 		return subcommands.ExitUsageError
 	}
 
-	if !p.swap && !p.location {
+	if !p.swap && !p.location && !p.previews {
 		p.swap = true
 		p.location = true
 	}
+	exportFormat := ""
+	if p.exportPath != "" {
+		var err error
+		if exportFormat, err = inspect.ExportFormat(p.exportPath); err != nil {
+			ErrPrint(ctx, err)
+			return subcommands.ExitUsageError
+		}
+	}
+	// exports and assertions need the data they use, even if it wasn't asked for:
+	p.location = p.location || p.failIfGPS || p.exportPath != ""
+	p.swap = p.swap || p.failIfSwapped || p.failIfNotSwapped
+
+	assertions := []*inspectAssertion{
+		{enabled: &p.failOnError, flag: "-fail-on-error", problem: "couldn't be read", code: exitInspectError,
+			failed: func(r inspect.Report) bool { return r.Error != "" }},
+		{enabled: &p.failIfGPS, flag: "-fail-if-gps", problem: "have GPS data", code: exitInspectGPS,
+			failed: func(r inspect.Report) bool { return (r.Location != nil && r.Location.HasGPS) || r.PreviewHasGPS() }},
+		{enabled: &p.failIfSwapped, flag: "-fail-if-swapped", problem: "have been camswapped", code: exitInspectSwapped,
+			failed: func(r inspect.Report) bool { return r.Swap != nil && r.Swap.Swapped }},
+		{enabled: &p.failIfNotSwapped, flag: "-fail-if-not-swapped", problem: "haven't been camswapped", code: exitInspectNotSwapped,
+			failed: func(r inspect.Report) bool { return r.Swap != nil && !r.Swap.Swapped }},
+	}
+	check := func(r inspect.Report) {
+		for _, a := range assertions {
+			if *a.enabled && a.failed(r) {
+				a.files = append(a.files, r.File)
+			}
+		}
+	}
 
 	p.appConfig = AppConfigFromCtx(ctx)
 
-	exiftoolConfigFilename, err := getExiftoolConfigFileName()
+	et, err := newExiftool(p.appConfig, false)
 	if err != nil {
 		ErrPrint(ctx, err)
 		return subcommands.ExitFailure
 	}
 	//goland:noinspection GoUnhandledErrorResult
-	defer func() { _ = os.Remove(exiftoolConfigFilename) }()
+	defer func() { _ = et.Close() }()
+
+	opts := inspect.Options{Swap: p.swap, Location: p.location, Zones: p.appConfig.PrivacyZones, Previews: p.previews, ExtractDir: p.extractDir}
+	if p.extractDir != "" {
+		if err := os.MkdirAll(p.extractDir, 0o755); err != nil {
+			ErrPrintf(ctx, "failed to create %s: %s\n", p.extractDir, err)
+			return subcommands.ExitFailure
+		}
+	}
+	if p.location && p.appConfig.GeoNames != nil {
+		if opts.Geocoder, err = geocode.Load(*p.appConfig.GeoNames); err != nil {
+			ErrPrintf(ctx, "failed to load GeoNames data: %s\n", err)
+			return subcommands.ExitFailure
+		}
+	}
 
-	swapExiftoolArgs := []string{"-j", "-f", "-Model", "-XtoolOriginalCameraModel"}
-	locationExiftoolArgs := []string{"-j", "-gps*"}
+	var reports []inspect.Report
+	if p.format != "text" {
+		inspect.Inspect(ctx, et, f.Args(), opts, func(r inspect.Report) {
+			reports = append(reports, r)
+			check(r)
+		})
+		if p.summary && p.format == "json" {
+			output := struct {
+				Summary inspect.Summary  `json:"summary"`
+				Files   []inspect.Report `json:"files"`
+			}{Summary: inspect.Summarize(reports)}
+			if p.detail {
+				output.Files = reports
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(output); err != nil {
+				ErrPrint(ctx, err)
+				return subcommands.ExitFailure
+			}
+		} else {
+			if !p.summary || p.detail {
+				if err := inspect.Write(os.Stdout, p.format, reports); err != nil {
+					ErrPrint(ctx, err)
+					return subcommands.ExitFailure
+				}
+			}
+			if p.summary {
+				if p.detail {
+					fmt.Println()
+				}
+				printSummary(inspect.Summarize(reports))
+			}
+		}
+		// keep stdout parseable:
+		if p.exportPath != "" && !p.export(ctx, exportFormat, reports, os.Stderr) {
+			return subcommands.ExitFailure
+		}
+		return inspectAssertionsResult(os.Stderr, assertions)
+	}
 
 	fmt.Println()
+	inspect.Inspect(ctx, et, f.Args(), opts, func(r inspect.Report) {
+		if !p.summary || p.detail {
+			printReport(r)
+		}
+		reports = append(reports, r)
+		check(r)
+	})
+	if p.summary {
+		printSummary(inspect.Summarize(reports))
+	}
+	if p.exportPath != "" && !p.export(ctx, exportFormat, reports, os.Stdout) {
+		return subcommands.ExitFailure
+	}
+	return inspectAssertionsResult(os.Stdout, assertions)
+}
+
+// export writes the positions in reports to p.exportPath, and reports how many it wrote to w.
+// It reports whether it succeeded.
+func (p *inspectCmd) export(ctx context.Context, format string, reports []inspect.Report, w io.Writer) bool {
+	exportFile, err := os.Create(p.exportPath)
+	if err != nil {
+		ErrPrintf(ctx, "failed to create export file: %s\n", err)
+		return false
+	}
+	n, err := inspect.Export(exportFile, format, reports)
+	if closeErr := exportFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		ErrPrintf(ctx, "failed to write export file: %s\n", err)
+		return false
+	}
+	_, _ = color.New(color.Bold, color.FgWhite).Fprintf(w, "inspect: exported %d locations to %s.\n", n, p.exportPath)
+	return true
+}
 
+// printSummary prints s as text.
+func printSummary(s inspect.Summary) {
 	boldWhitePrintf := color.New(color.Bold, color.FgWhite).PrintfFunc()
-	boldGreenPrintf := color.New(color.FgGreen).PrintfFunc()
 
-	gpsTagAllowlist := []string{"GPSVersionID", "SourceFile"}
+	boldWhitePrintf("inspect: %d images.\n", s.Files)
+	if s.Swap != nil {
+		fmt.Printf("%s %d\n", color.MagentaString("Camswapped:"), s.Swap.Swapped)
+		for _, swap := range s.Swap.Swaps {
+			fmt.Printf("\t%s → %s: %d\n", orNone(swap.OriginalModel), orNone(swap.Model), swap.Files)
+		}
+	}
+	if s.Location != nil {
+		fmt.Printf("%s %d\n", color.MagentaString("With GPS data:"), s.Location.WithGPS)
+		fmt.Printf("%s %d\n", color.MagentaString("With place names:"), s.Location.WithPlaceNames)
+		if s.Location.InPrivacyZones != 0 {
+			fmt.Printf("%s %d\n", color.MagentaString("Inside privacy zones:"), s.Location.InPrivacyZones)
+		}
+	}
+	if s.PreviewsWithGPS != 0 {
+		fmt.Printf("%s %d\n", color.MagentaString("With GPS data in embedded images:"), s.PreviewsWithGPS)
+	}
+	if len(s.Models) != 0 {
+		fmt.Printf("%s\n", color.MagentaString("Camera models:"))
+		for _, model := range s.Models {
+			fmt.Printf("\t%s: %d\n", orNone(model.Model), model.Files)
+		}
+	}
+	fmt.Printf("%s %d\n", color.MagentaString("Unreadable:"), len(s.Unreadable))
+	for _, unreadable := range s.Unreadable {
+		fmt.Printf("\t%s %s\n", color.MagentaString("%s:", unreadable.File), unreadable.Error)
+	}
+	fmt.Println()
+}
 
-	for _, imgFilename := range f.Args() {
-		boldWhitePrintf("%s ...\n", imgFilename)
+// inspectAssertionsResult prints a summary of the files that failed each assertion to w, and
+// returns the exit status for the first failed assertion.
+func inspectAssertionsResult(w io.Writer, assertions []*inspectAssertion) subcommands.ExitStatus {
+	status := subcommands.ExitSuccess
+	for _, a := range assertions {
+		if len(a.files) == 0 {
+			continue
+		}
+		if status == subcommands.ExitSuccess {
+			status = a.code
+		}
+		_, _ = color.New(color.Bold, color.FgRed).Fprintf(w, "%s: %d files %s:\n", a.flag, len(a.files), a.problem)
+		for _, file := range a.files {
+			_, _ = fmt.Fprintf(w, "- %s\n", color.MagentaString(file))
+		}
+	}
+	return status
+}
 
-		if p.swap {
-			fullArgs := make([]string, len(swapExiftoolArgs)+1)
-			copy(fullArgs, swapExiftoolArgs)
-			fullArgs[len(swapExiftoolArgs)] = imgFilename
+// printReport prints r as text.
+func printReport(r inspect.Report) {
+	boldWhitePrintf := color.New(color.Bold, color.FgWhite).PrintfFunc()
+	boldGreenPrintf := color.New(color.FgGreen).PrintfFunc()
+	boldRedPrintf := color.New(color.Bold, color.FgRed).PrintfFunc()
 
-			cmd := exec.Command(p.appConfig.ExiftoolBin, fullArgs...)
-			cmdOut, err := cmd.CombinedOutput()
-			if err != nil {
-				fmt.Printf("\tfailed to run exiftool: %s\n\n", err)
-				continue
-			}
-			var result []map[string]string
-			err = json.Unmarshal(cmdOut, &result)
-			if err != nil {
-				fmt.Printf("\tfailed to parse exiftool result as JSON: %s\n\n", err)
-				continue
-			}
-			if len(result) != 1 {
-				fmt.Printf("\tinvalid exiftool output: expected 1 item, got %d\n\n", len(result))
-				continue
-			}
+	boldWhitePrintf("%s ...\n", r.File)
+	if r.Error != "" {
+		fmt.Printf("\t%s\n\n", r.Error)
+		return
+	}
 
-			metadata := result[0]
-			if swapped, ok := metadata["XtoolOriginalCameraModel"]; ok && swapped != "-" {
-				fmt.Printf("\t%s %s\n", color.MagentaString("Original Camera Model:"), swapped)
-				if model, ok := metadata["Model"]; ok {
-					fmt.Printf("\t%s %s\n", color.MagentaString("Swapped Camera Model:"), model)
+	if swap := r.Swap; swap != nil {
+		if swap.Swapped {
+			for _, tag := range camswap.IdentityTags {
+				if !slices.Contains(swap.SwappedTags, tag.Name) {
+					continue
 				}
-			} else {
-				boldGreenPrintf("\t✔ No camera swap metadata.\n")
-				if model, ok := metadata["Model"]; ok {
-					fmt.Printf("\t%s %s\n", color.MagentaString("Camera Model:"), model)
+				fmt.Printf("\t%s %s\n", color.MagentaString("Original %s:", tag.Label), valueOrNone(swap.Originals, tag.Name))
+				fmt.Printf("\t%s %s\n", color.MagentaString("Swapped %s:", tag.Label), valueOrNone(swap.Current, tag.Name))
+			}
+			if len(swap.History) > 1 {
+				fmt.Printf("\t%s\n", color.MagentaString("Swap History:"))
+				for i, entry := range swap.History {
+					at := entry.At
+					if at == "" {
+						at = "unknown time"
+					}
+					fmt.Printf("\t  %d. %s: swapped from %s\n", i+1, at, orNone(entry.PreviousValue("Model", swap.Originals)))
 				}
 			}
-			fmt.Println()
+		} else {
+			boldGreenPrintf("\t✔ No camera swap metadata.\n")
+			if model, ok := swap.Current["Model"]; ok {
+				fmt.Printf("\t%s %s\n", color.MagentaString("Camera Model:"), model)
+			}
 		}
+		fmt.Println()
+	}
 
-		if p.location {
-			fullArgs := make([]string, len(locationExiftoolArgs)+1)
-			copy(fullArgs, locationExiftoolArgs)
-			fullArgs[len(locationExiftoolArgs)] = imgFilename
-
-			cmd := exec.Command(p.appConfig.ExiftoolBin, fullArgs...)
-			cmdOut, err := cmd.CombinedOutput()
-			if err != nil {
-				fmt.Printf("\tfailed to run exiftool: %s\n\n", err)
-				continue
-			}
-			var result []map[string]interface{}
-			err = json.Unmarshal(cmdOut, &result)
-			if err != nil {
-				fmt.Printf("\tfailed to parse exiftool result as JSON: %s\n\n", err)
-				continue
+	if loc := r.Location; loc != nil {
+		switch loc.Stash {
+		case "xmp":
+			fmt.Printf("\t%s in an encrypted XMP attribute; restore it with rmloc -r\n", color.YellowString("Location stashed:"))
+		case "sidecar":
+			fmt.Printf("\t%s in %s; restore it with rmloc -r\n", color.YellowString("Location stashed:"), rmloc.SidecarPath(r.File))
+		}
+		if loc.Precision != nil {
+			fmt.Printf("\t%s rounded to a %s° grid by rmloc -coarsen\n", color.YellowString("Location coarsened:"), strconv.FormatFloat(*loc.Precision, 'f', -1, 64))
+		}
+		if len(loc.Tags) == 0 {
+			boldGreenPrintf("\t✔ No GPS or place name metadata.\n")
+		} else {
+			for _, k := range loc.SortedTags() {
+				fmt.Printf("\t%s %s\n", color.MagentaString("%s:", k), loc.Tags[k])
 			}
-			if len(result) != 1 {
-				fmt.Printf("\tinvalid exiftool output: expected 1 item, got %d\n\n", len(result))
-				continue
+			if loc.Place != nil {
+				fmt.Printf("\t%s %s (%.1f km from its center)\n", color.MagentaString("Place:"), loc.Place, loc.Place.DistanceMeters/1000)
 			}
-
-			metadata := result[0]
-			for _, k := range gpsTagAllowlist {
-				delete(metadata, k)
+			if loc.PrivacyZone != "" {
+				boldRedPrintf("\t⚠ Inside privacy zone: %s\n", loc.PrivacyZone)
 			}
-			if len(metadata) == 0 {
-				boldGreenPrintf("\t✔ No GPS metadata.\n")
-			} else {
-				keys := make([]string, 0, len(metadata))
-				for k := range metadata {
-					keys = append(keys, k)
-				}
-				sort.Strings(keys)
+		}
+		fmt.Println()
+	}
 
-				for _, k := range keys {
-					fmt.Printf("\t%s %s\n", color.MagentaString("%s:", k), metadata[k])
-				}
+	if r.PreviewErr != "" {
+		boldRedPrintf("\t⚠ Couldn't inspect embedded images: %s\n\n", r.PreviewErr)
+	} else if r.Previews != nil {
+		if len(r.Previews) == 0 {
+			boldGreenPrintf("\t✔ No embedded previews or thumbnails.\n")
+		}
+		for _, preview := range r.Previews {
+			fmt.Printf("\t%s %s\n", color.MagentaString("Embedded Image:"), preview)
+			if preview.Extracted != "" {
+				fmt.Printf("\t  extracted to %s\n", preview.Extracted)
 			}
-			fmt.Println()
 		}
+		if r.PreviewHasGPS() {
+			boldRedPrintf("\t⚠ An embedded image has GPS data; remove it with rmloc -deep\n")
+		}
+		fmt.Println()
 	}
+}
 
-	return subcommands.ExitSuccess
+// valueOrNone returns values[key], or "(none)" if it's not set.
+func valueOrNone(values map[string]string, key string) string {
+	if value, ok := values[key]; ok {
+		return value
+	}
+	return "(none)"
+}
+
+// orNone returns value, or "(none)" if it's empty.
+func orNone(value string) string {
+	if value == "" {
+		return "(none)"
+	}
+	return value
 }
@@ -0,0 +1,202 @@
+package inspect
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportFormats maps the file extensions Export supports to their formats.
+var ExportFormats = map[string]string{
+	".geojson": "geojson",
+	".json":    "geojson",
+	".gpx":     "gpx",
+	".kml":     "kml",
+}
+
+// ExportFormat returns the export format for the given file name, by its extension.
+func ExportFormat(path string) (string, error) {
+	if format, ok := ExportFormats[strings.ToLower(filepath.Ext(path))]; ok {
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported export file type '%s' (supported: .geojson, .gpx, .kml)", filepath.Ext(path))
+}
+
+// Export writes the GPS positions of reports to w in the given format (see ExportFormats), as one
+// GeoJSON feature, GPX waypoint, or KML placemark per geotagged file, with the file's name,
+// capture time, and camera. Reports without a GPS position are skipped. It returns the number of
+// positions written.
+func Export(w io.Writer, format string, reports []Report) (int, error) {
+	var located []Report
+	for _, r := range reports {
+		if r.Location != nil && r.Location.Latitude != nil && r.Location.Longitude != nil {
+			located = append(located, r)
+		}
+	}
+
+	var err error
+	switch format {
+	case "geojson":
+		err = exportGeoJSON(w, located)
+	case "gpx":
+		err = exportGPX(w, located)
+	case "kml":
+		err = exportKML(w, located)
+	default:
+		err = fmt.Errorf("unsupported export format '%s'", format)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(located), nil
+}
+
+// utcTime returns r's capture time in UTC, if its UTC offset is known; GPX and KML timestamps
+// can't represent a local time in an unknown time zone.
+func utcTime(r Report) (string, bool) {
+	t, err := time.Parse(time.RFC3339, r.CaptureTime)
+	if err != nil {
+		return "", false
+	}
+	return t.UTC().Format(time.RFC3339), true
+}
+
+// description returns a one-line description of r for GPX and KML.
+func description(r Report) string {
+	var parts []string
+	if r.CaptureTime != "" {
+		parts = append(parts, "Captured "+r.CaptureTime)
+	}
+	if r.Camera != "" {
+		parts = append(parts, "Camera: "+r.Camera)
+	}
+	if r.Location != nil && r.Location.Place != nil {
+		parts = append(parts, "Near "+r.Location.Place.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+func exportGeoJSON(w io.Writer, reports []Report) error {
+	type feature struct {
+		Type     string `json:"type"`
+		Geometry struct {
+			Type        string     `json:"type"`
+			Coordinates [2]float64 `json:"coordinates"` // GeoJSON positions are [lon, lat]
+		} `json:"geometry"`
+		Properties struct {
+			File        string `json:"file"`
+			Name        string `json:"name"`
+			CaptureTime string `json:"capture_time"`
+			Camera      string `json:"camera"`
+			PrivacyZone string `json:"privacy_zone,omitempty"`
+			Place       string `json:"place,omitempty"`
+		} `json:"properties"`
+	}
+	collection := struct {
+		Type     string    `json:"type"`
+		Features []feature `json:"features"`
+	}{Type: "FeatureCollection", Features: []feature{}}
+
+	for _, r := range reports {
+		var f feature
+		f.Type = "Feature"
+		f.Geometry.Type = "Point"
+		f.Geometry.Coordinates = [2]float64{*r.Location.Longitude, *r.Location.Latitude}
+		f.Properties.File = r.File
+		f.Properties.Name = filepath.Base(r.File)
+		f.Properties.CaptureTime = r.CaptureTime
+		f.Properties.Camera = r.Camera
+		f.Properties.PrivacyZone = r.Location.PrivacyZone
+		if r.Location.Place != nil {
+			f.Properties.Place = r.Location.Place.String()
+		}
+		collection.Features = append(collection.Features, f)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(collection)
+}
+
+func exportGPX(w io.Writer, reports []Report) error {
+	type waypoint struct {
+		Lat  string `xml:"lat,attr"`
+		Lon  string `xml:"lon,attr"`
+		Time string `xml:"time,omitempty"`
+		Name string `xml:"name"`
+		Desc string `xml:"desc,omitempty"`
+	}
+	gpx := struct {
+		XMLName   xml.Name   `xml:"gpx"`
+		Version   string     `xml:"version,attr"`
+		Creator   string     `xml:"creator,attr"`
+		Namespace string     `xml:"xmlns,attr"`
+		Waypoints []waypoint `xml:"wpt"`
+	}{Version: "1.1", Creator: "xtool", Namespace: "http://www.topografix.com/GPX/1/1"}
+
+	for _, r := range reports {
+		wpt := waypoint{
+			Lat:  formatCoordinate(*r.Location.Latitude),
+			Lon:  formatCoordinate(*r.Location.Longitude),
+			Name: filepath.Base(r.File),
+			Desc: description(r),
+		}
+		wpt.Time, _ = utcTime(r)
+		gpx.Waypoints = append(gpx.Waypoints, wpt)
+	}
+	return writeXML(w, gpx)
+}
+
+func exportKML(w io.Writer, reports []Report) error {
+	type placemark struct {
+		Name        string `xml:"name"`
+		Description string `xml:"description,omitempty"`
+		TimeStamp   *struct {
+			When string `xml:"when"`
+		} `xml:"TimeStamp,omitempty"`
+		Coordinates string `xml:"Point>coordinates"` // KML coordinates are lon,lat
+	}
+	kml := struct {
+		XMLName    xml.Name    `xml:"kml"`
+		Namespace  string      `xml:"xmlns,attr"`
+		Name       string      `xml:"Document>name"`
+		Placemarks []placemark `xml:"Document>Placemark"`
+	}{Namespace: "http://www.opengis.net/kml/2.2", Name: "xtool photo locations"}
+
+	for _, r := range reports {
+		p := placemark{
+			Name:        filepath.Base(r.File),
+			Description: description(r),
+			Coordinates: formatCoordinate(*r.Location.Longitude) + "," + formatCoordinate(*r.Location.Latitude),
+		}
+		if when, ok := utcTime(r); ok {
+			p.TimeStamp = &struct {
+				When string `xml:"when"`
+			}{When: when}
+		}
+		kml.Placemarks = append(kml.Placemarks, p)
+	}
+	return writeXML(w, kml)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func formatCoordinate(degrees float64) string {
+	return strconv.FormatFloat(degrees, 'f', 6, 64)
+}
@@ -0,0 +1,140 @@
+package inspect
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formats lists the structured output formats Write supports.
+var Formats = []string{"json", "csv", "table"}
+
+// CSVHeader is the header row of Write's CSV output. Columns for a section that wasn't inspected
+// are left empty. Columns may be added at the end, but not renamed, reordered, or removed.
+var CSVHeader = []string{
+	"file", "error",
+	"swapped", "model", "original_model", "swapped_tags", "swap_count",
+	"has_gps", "has_place_names", "latitude", "longitude", "coarsened_precision", "stash", "privacy_zone", "location_tags",
+	"capture_time", "camera", "place", "previews", "preview_error",
+}
+
+// CSVRecord returns r's row in Write's CSV output. List values are separated by "; ".
+func (r Report) CSVRecord() []string {
+	record := []string{r.File, r.Error}
+	if r.Swap != nil {
+		record = append(record,
+			strconv.FormatBool(r.Swap.Swapped),
+			r.Swap.Model,
+			r.Swap.OriginalModel,
+			strings.Join(r.Swap.SwappedTags, "; "),
+			strconv.Itoa(len(r.Swap.History)),
+		)
+	} else {
+		record = append(record, "", "", "", "", "")
+	}
+	if r.Location != nil {
+		var tags []string
+		for _, k := range r.Location.SortedTags() {
+			tags = append(tags, k+"="+r.Location.Tags[k])
+		}
+		record = append(record,
+			strconv.FormatBool(r.Location.HasGPS),
+			strconv.FormatBool(r.Location.HasPlaceNames),
+			formatFloat(r.Location.Latitude),
+			formatFloat(r.Location.Longitude),
+			formatFloat(r.Location.Precision),
+			r.Location.Stash,
+			r.Location.PrivacyZone,
+			strings.Join(tags, "; "),
+		)
+	} else {
+		record = append(record, "", "", "", "", "", "", "", "")
+	}
+	record = append(record, r.CaptureTime, r.Camera)
+	if r.Location != nil && r.Location.Place != nil {
+		record = append(record, r.Location.Place.String())
+	} else {
+		record = append(record, "")
+	}
+	var previews []string
+	for _, p := range r.Previews {
+		previews = append(previews, p.String())
+	}
+	return append(record, strings.Join(previews, "; "), r.PreviewErr)
+}
+
+func formatFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+// Write writes reports to w in the given format, one of Formats: a JSON array of Reports, CSV
+// with CSVHeader, or a human-readable table.
+func Write(w io.Writer, format string, reports []Report) error {
+	switch format {
+	case "json":
+		if reports == nil {
+			reports = []Report{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(CSVHeader); err != nil {
+			return err
+		}
+		for _, r := range reports {
+			if err := cw.Write(r.CSVRecord()); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+		return writeTable(w, reports)
+	}
+	return fmt.Errorf("unsupported output format '%s' (supported: %s)", format, strings.Join(Formats, ", "))
+}
+
+func writeTable(w io.Writer, reports []Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "FILE\tSWAPPED\tMODEL\tORIGINAL MODEL\tGPS\tLATITUDE\tLONGITUDE\tPRIVACY ZONE\tERROR")
+	for _, r := range reports {
+		row := []string{r.File, "-", "-", "-", "-", "-", "-", "-", "-"}
+		if r.Swap != nil {
+			row[1] = yesNo(r.Swap.Swapped)
+			row[2] = orDash(r.Swap.Model)
+			row[3] = orDash(r.Swap.OriginalModel)
+		}
+		if r.Location != nil {
+			row[4] = yesNo(r.Location.HasGPS)
+			row[5] = orDash(formatFloat(r.Location.Latitude))
+			row[6] = orDash(formatFloat(r.Location.Longitude))
+			row[7] = orDash(r.Location.PrivacyZone)
+		}
+		row[8] = orDash(r.Error)
+		_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
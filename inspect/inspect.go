@@ -0,0 +1,225 @@
+// Package inspect reports the camera-swap and location metadata in image files, as structured
+// Reports which can be rendered as JSON, CSV, or a table.
+package inspect
+
+import (
+	"context"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"xtool/camswap"
+	"xtool/exif"
+	"xtool/geocode"
+	"xtool/rmloc"
+)
+
+// BatchSize is the number of files Inspect reads with each exiftool invocation.
+const BatchSize = 500
+
+// Options select what Inspect reports.
+type Options struct {
+	Swap     bool              // report camera-swap data
+	Location bool              // report GPS and place name data
+	Zones    []rmloc.Zone      // privacy zones to check locations against
+	Geocoder *geocode.Geocoder // if set, locations are reverse geocoded to the nearest city
+
+	Previews   bool   // report embedded preview images and thumbnails
+	ExtractDir string // if set, embedded images are extracted to this directory
+}
+
+// Report is the result of inspecting one file. Its JSON encoding is a stable schema; fields may
+// be added, but not renamed or removed.
+type Report struct {
+	File        string          `json:"file"`
+	Error       string          `json:"error"`         // empty if the file was read successfully
+	CaptureTime string          `json:"capture_time"`  // DateTimeOriginal, in RFC 3339 format if its UTC offset is known, else without an offset
+	Camera      string          `json:"camera"`        // current camera model
+	Swap        *SwapReport     `json:"swap"`          // nil if camera-swap data wasn't inspected or the file couldn't be read
+	Location    *LocationReport `json:"location"`      // nil if location data wasn't inspected or the file couldn't be read
+	Previews    []PreviewReport `json:"previews"`      // nil if embedded images weren't inspected or the file couldn't be read
+	PreviewErr  string          `json:"preview_error"` // set if embedded images were to be inspected, but couldn't be
+}
+
+// SwapReport describes a file's camera-swap data.
+type SwapReport struct {
+	Swapped       bool                   `json:"swapped"`
+	Model         string                 `json:"model"`          // current camera model
+	OriginalModel string                 `json:"original_model"` // empty unless the model has been swapped
+	SwappedTags   []string               `json:"swapped_tags"`   // identity tags changed from their original values
+	Current       map[string]string      `json:"current"`        // current identity tag values
+	Originals     map[string]string      `json:"originals"`      // original values of SwappedTags
+	History       []camswap.HistoryEntry `json:"history"`        // oldest first
+}
+
+// LocationReport describes a file's location data.
+type LocationReport struct {
+	HasGPS        bool              `json:"has_gps"`
+	HasPlaceNames bool              `json:"has_place_names"`
+	Latitude      *float64          `json:"latitude"`            // signed decimal degrees; nil if the file has no GPS position
+	Longitude     *float64          `json:"longitude"`           // signed decimal degrees; nil if the file has no GPS position
+	Precision     *float64          `json:"coarsened_precision"` // grid size, in degrees, rmloc -coarsen rounded the location to
+	Stash         string            `json:"stash"`               // where rmloc -stash stashed the removed location: "xmp", "sidecar", or empty
+	PrivacyZone   string            `json:"privacy_zone"`        // name of the privacy zone containing the location, if any
+	Place         *geocode.Place    `json:"place"`               // the city nearest the location; nil if it wasn't reverse geocoded or no city is nearby
+	Tags          map[string]string `json:"tags"`                // every GPS and place name tag found
+}
+
+// Args returns the exiftool arguments that read the tags FromMetadata needs.
+func Args(opts Options) []string {
+	args := []string{"-Model", "-DateTimeOriginal", "-OffsetTimeOriginal"}
+	if opts.Swap {
+		args = append(args, camswap.StateArgs()...)
+	}
+	if opts.Location {
+		args = append(args, rmloc.LocationArgs(true)...)
+		args = append(args, "-"+exif.TagLocationPrecision, "-"+exif.TagLocationStash)
+	}
+	if opts.Previews {
+		args = append(args, previewArgs()...)
+	}
+	return args
+}
+
+// FromMetadata returns the report for file, whose metadata must have been read with Args.
+func FromMetadata(file string, m exif.Metadata, opts Options) Report {
+	report := Report{File: file, CaptureTime: captureTime(m)}
+	report.Camera, _ = m.String("Model")
+	if opts.Swap {
+		state, err := camswap.StateFromMetadata(m)
+		if err != nil {
+			report.Error = err.Error()
+			return report
+		}
+		report.Swap = swapReport(state)
+	}
+	if opts.Location {
+		report.Location = locationReport(file, m, opts)
+	}
+	return report
+}
+
+// captureTime returns the DateTimeOriginal in m, formatted as Report.CaptureTime.
+func captureTime(m exif.Metadata) string {
+	dateTime, ok := m.String("DateTimeOriginal")
+	if !ok {
+		return ""
+	}
+	if offset, ok := m.String("OffsetTimeOriginal"); ok && offset != "" {
+		if loc, err := exif.ParseOffset(offset); err == nil {
+			if t, err := exif.ParseDateTime(dateTime, loc); err == nil {
+				return t.Format(time.RFC3339)
+			}
+		}
+	}
+	t, err := exif.ParseDateTime(dateTime, time.UTC)
+	if err != nil {
+		return ""
+	}
+	return t.Format("2006-01-02T15:04:05")
+}
+
+func swapReport(state camswap.State) *SwapReport {
+	r := &SwapReport{
+		Swapped:     state.Swapped(),
+		Model:       state.Current["Model"],
+		SwappedTags: append([]string{}, state.SwappedTags...),
+		Current:     state.Current,
+		Originals:   make(map[string]string),
+		History:     append([]camswap.HistoryEntry{}, state.History...),
+	}
+	for _, tag := range state.SwappedTags {
+		if value, ok := state.Originals[tag]; ok {
+			r.Originals[tag] = value
+		}
+	}
+	r.OriginalModel = r.Originals["Model"]
+	return r
+}
+
+func locationReport(file string, m exif.Metadata, opts Options) *LocationReport {
+	r := &LocationReport{Tags: make(map[string]string)}
+
+	// the location tags are reported alongside any camera-swap tags, so pick out just the former:
+	ignored := []string{"SourceFile", "DateTimeOriginal", "OffsetTimeOriginal", "GPSVersionID", exif.TagSwappedTags, exif.TagSwapHistory, exif.TagLocationPrecision, exif.TagLocationStash}
+	for _, tag := range camswap.IdentityTags {
+		ignored = append(ignored, tag.Name, tag.StashTag)
+	}
+	ignored = append(ignored, rmloc.PreviewTags...)
+	for key := range m {
+		if slices.Contains(ignored, key) {
+			continue
+		}
+		r.Tags[key], _ = m.String(key)
+		if strings.HasPrefix(key, "GPS") {
+			r.HasGPS = true
+		} else {
+			r.HasPlaceNames = true
+		}
+	}
+
+	if loc, ok := rmloc.LocationFromMetadata(m); ok {
+		r.Latitude, r.Longitude = &loc.Latitude, &loc.Longitude
+		if zone, inZone := rmloc.ZoneContaining(opts.Zones, loc); inZone {
+			r.PrivacyZone = zone.Name
+		}
+		if opts.Geocoder != nil {
+			if place, found := opts.Geocoder.Lookup(loc); found {
+				r.Place = &place
+			}
+		}
+	}
+	if precision, ok := m.String(exif.TagLocationPrecision); ok && len(r.Tags) != 0 {
+		if grid, err := strconv.ParseFloat(precision, 64); err == nil {
+			r.Precision = &grid
+		}
+	}
+	if _, ok := m[exif.TagLocationStash]; ok {
+		r.Stash = "xmp"
+	} else if _, err := os.Stat(rmloc.SidecarPath(file)); err == nil {
+		r.Stash = "sidecar"
+	}
+	return r
+}
+
+// SortedTags returns the names of the location tags in r, sorted.
+func (r *LocationReport) SortedTags() []string {
+	keys := make([]string, 0, len(r.Tags))
+	for k := range r.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Inspect reads files' metadata, BatchSize files per exiftool invocation, and calls each with
+// the report for each file, in order. A file that can't be read is reported with its Error set.
+func Inspect(ctx context.Context, et *exif.Exiftool, files []string, opts Options, each func(Report)) {
+	args := Args(opts)
+	for len(files) != 0 {
+		batch := files[:min(len(files), BatchSize)]
+		files = files[len(batch):]
+
+		metadata, errs, batchErr := et.ReadJSONEach(ctx, args, batch)
+		for _, file := range batch {
+			err := batchErr
+			if err == nil {
+				err = errs[file]
+			}
+			if err != nil {
+				each(Report{File: file, Error: err.Error()})
+				continue
+			}
+			report := FromMetadata(file, metadata[file], opts)
+			if opts.Previews && report.Error == "" {
+				if report.Previews, err = Previews(ctx, et, file, metadata[file], opts.ExtractDir); err != nil {
+					report.PreviewErr = err.Error()
+				}
+			}
+			each(report)
+		}
+	}
+}
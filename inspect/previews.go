@@ -0,0 +1,171 @@
+package inspect
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // embedded previews are almost always JPEGs
+	_ "image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"xtool/exif"
+	"xtool/rmloc"
+)
+
+// PreviewReport describes one image embedded in a file: a thumbnail, preview, or full-size JPEG
+// from a RAW file. Embedded images may show the image as it was before it was cropped or edited,
+// and may carry their own metadata, which tools like rmloc that edit the file's own metadata
+// don't touch by default.
+type PreviewReport struct {
+	Tag       string `json:"tag"`       // ThumbnailImage, PreviewImage, JpgFromRaw, or OtherImage
+	Width     int    `json:"width"`     // 0 if the image's dimensions couldn't be read
+	Height    int    `json:"height"`    // 0 if the image's dimensions couldn't be read
+	Bytes     int    `json:"bytes"`     // size of the embedded image
+	HasEXIF   bool   `json:"has_exif"`  // whether the embedded image carries its own EXIF metadata
+	HasGPS    bool   `json:"has_gps"`   // whether the embedded image carries its own GPS metadata
+	Extracted string `json:"extracted"` // path the image was extracted to; empty if it wasn't
+}
+
+// String describes p in one line, eg. "ThumbnailImage: 160x120, 5.2 KB, own EXIF".
+func (p PreviewReport) String() string {
+	desc := p.Tag + ": "
+	if p.Width != 0 {
+		desc += fmt.Sprintf("%dx%d, ", p.Width, p.Height)
+	}
+	desc += fmt.Sprintf("%.1f KB", float64(p.Bytes)/1024)
+	if p.HasGPS {
+		desc += ", own EXIF with GPS"
+	} else if p.HasEXIF {
+		desc += ", own EXIF"
+	}
+	return desc
+}
+
+// PreviewHasGPS reports whether any image embedded in r's file carries its own GPS metadata.
+func (r Report) PreviewHasGPS() bool {
+	for _, p := range r.Previews {
+		if p.HasGPS {
+			return true
+		}
+	}
+	return false
+}
+
+// previewExtension returns the file extension for an embedded image, by its content: most are
+// JPEGs, but some formats embed TIFF or PNG previews.
+func previewExtension(data []byte) string {
+	if _, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		switch format {
+		case "jpeg":
+			return ".jpg"
+		case "png":
+			return ".png"
+		}
+	}
+	if bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")) {
+		return ".tif"
+	}
+	return ".bin"
+}
+
+// createExclusive creates a new file for name in dir, named name+ext or, if that exists, with a
+// number appended (eg. photo_PreviewImage-2.jpg), so files extracted from same-named images in
+// different directories don't overwrite each other.
+func createExclusive(dir, name, ext string) (*os.File, error) {
+	for i := 1; ; i++ {
+		path := filepath.Join(dir, name+ext)
+		if i > 1 {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", name, i, ext))
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+// previewArgs returns the exiftool arguments that report which PreviewTags a file has.
+func previewArgs() []string {
+	args := make([]string, 0, len(rmloc.PreviewTags))
+	for _, tag := range rmloc.PreviewTags {
+		args = append(args, "-"+tag)
+	}
+	return args
+}
+
+// Previews extracts each image embedded in file, whose metadata m must have been read with
+// previewArgs, and reports on it. If extractDir is set, each image is saved there, named like
+// photo_PreviewImage.jpg, with an extension matching its format; existing files aren't
+// overwritten. Otherwise, it's saved only temporarily, to read its metadata.
+func Previews(ctx context.Context, et *exif.Exiftool, file string, m exif.Metadata, extractDir string) ([]PreviewReport, error) {
+	tmpDir, err := os.MkdirTemp("", "xtool_inspect")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	reports := []PreviewReport{}
+	for _, tag := range rmloc.PreviewTags {
+		if _, ok := m[tag]; !ok {
+			continue
+		}
+		data, err := et.ExtractBinary(ctx, tag, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %w", tag, err)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		r := PreviewReport{Tag: tag, Bytes: len(data)}
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			r.Width, r.Height = cfg.Width, cfg.Height
+		}
+
+		dir, name := tmpDir, tag
+		if extractDir != "" {
+			base := filepath.Base(file)
+			dir, name = extractDir, strings.TrimSuffix(base, filepath.Ext(base))+"_"+tag
+		}
+		f, err := createExclusive(dir, name, previewExtension(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create a file for %s: %w", tag, err)
+		}
+		previewFile := f.Name()
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s to '%s': %w", tag, previewFile, err)
+		}
+		if extractDir != "" {
+			r.Extracted = previewFile
+		}
+
+		// -G0 prefixes each tag with its family 0 group, eg. "EXIF:Model":
+		result, err := et.ReadJSON(ctx, []string{"-G0", "-EXIF:all", "-gps*"}, previewFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s metadata: %w", tag, err)
+		}
+		if len(result) != 1 {
+			return nil, fmt.Errorf("invalid exiftool output: expected 1 item, got %d", len(result))
+		}
+		for key := range result[0] {
+			group, name, _ := strings.Cut(key, ":")
+			if group == "EXIF" {
+				r.HasEXIF = true
+			}
+			if strings.HasPrefix(name, "GPS") && name != "GPSVersionID" {
+				r.HasGPS = true
+			}
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
@@ -0,0 +1,117 @@
+package inspect
+
+import (
+	"sort"
+)
+
+// Summary aggregates the reports for many files.
+type Summary struct {
+	Files           int              `json:"files"`
+	Swap            *SwapSummary     `json:"swap"`              // nil if camera-swap data wasn't inspected
+	Location        *LocationSummary `json:"location"`          // nil if location data wasn't inspected
+	PreviewsWithGPS int              `json:"previews_with_gps"` // files with an embedded preview or thumbnail carrying its own GPS data
+	Models          []ModelCount     `json:"models"`            // distinct camera models, as currently recorded in the files
+	Unreadable      []UnreadableFile `json:"unreadable"`        // files that couldn't be read
+}
+
+// SwapSummary aggregates the camera-swap data of many files.
+type SwapSummary struct {
+	Swapped int         `json:"swapped"` // files that have been camswapped
+	Swaps   []SwapCount `json:"swaps"`   // swapped files, grouped by original and swapped model
+}
+
+// LocationSummary aggregates the location data of many files.
+type LocationSummary struct {
+	WithGPS        int `json:"with_gps"`         // files with GPS data
+	WithPlaceNames int `json:"with_place_names"` // files with place names
+	InPrivacyZones int `json:"in_privacy_zones"` // files located inside a configured privacy zone
+}
+
+// SwapCount is the number of files swapped from one camera model to another.
+type SwapCount struct {
+	OriginalModel string `json:"original_model"`
+	Model         string `json:"model"`
+	Files         int    `json:"files"`
+}
+
+// ModelCount is the number of files recording a camera model.
+type ModelCount struct {
+	Model string `json:"model"` // empty for files with no camera model
+	Files int    `json:"files"`
+}
+
+// UnreadableFile is a file that couldn't be read, and why.
+type UnreadableFile struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// Summarize aggregates reports. Swaps and Models are sorted by descending file count.
+func Summarize(reports []Report) Summary {
+	s := Summary{
+		Files:      len(reports),
+		Models:     []ModelCount{},
+		Unreadable: []UnreadableFile{},
+	}
+	swaps := make(map[[2]string]int)
+	models := make(map[string]int)
+	for _, r := range reports {
+		if r.Error != "" {
+			s.Unreadable = append(s.Unreadable, UnreadableFile{File: r.File, Error: r.Error})
+			continue
+		}
+		models[r.Camera]++
+		if r.Swap != nil {
+			if s.Swap == nil {
+				s.Swap = &SwapSummary{Swaps: []SwapCount{}}
+			}
+			if r.Swap.Swapped {
+				s.Swap.Swapped++
+				swaps[[2]string{r.Swap.OriginalModel, r.Swap.Model}]++
+			}
+		}
+		if r.Location != nil {
+			if s.Location == nil {
+				s.Location = &LocationSummary{}
+			}
+			if r.Location.HasGPS {
+				s.Location.WithGPS++
+			}
+			if r.Location.HasPlaceNames {
+				s.Location.WithPlaceNames++
+			}
+			if r.Location.PrivacyZone != "" {
+				s.Location.InPrivacyZones++
+			}
+		}
+		if r.PreviewHasGPS() {
+			s.PreviewsWithGPS++
+		}
+	}
+
+	if s.Swap != nil {
+		for pair, n := range swaps {
+			s.Swap.Swaps = append(s.Swap.Swaps, SwapCount{OriginalModel: pair[0], Model: pair[1], Files: n})
+		}
+		sort.Slice(s.Swap.Swaps, func(i, j int) bool {
+			a, b := s.Swap.Swaps[i], s.Swap.Swaps[j]
+			if a.Files != b.Files {
+				return a.Files > b.Files
+			}
+			if a.OriginalModel != b.OriginalModel {
+				return a.OriginalModel < b.OriginalModel
+			}
+			return a.Model < b.Model
+		})
+	}
+	for model, n := range models {
+		s.Models = append(s.Models, ModelCount{Model: model, Files: n})
+	}
+	sort.Slice(s.Models, func(i, j int) bool {
+		if s.Models[i].Files != s.Models[j].Files {
+			return s.Models[i].Files > s.Models[j].Files
+		}
+		return s.Models[i].Model < s.Models[j].Model
+	})
+	return s
+}
@@ -0,0 +1,61 @@
+package inspect
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		reports []Report
+		want    Summary
+	}{
+		{
+			name: "camera models only",
+			reports: []Report{
+				{File: "a.jpg", Camera: "Z 6"},
+				{File: "b.jpg", Camera: "X100V"},
+				{File: "c.jpg", Camera: "Z 6"},
+				{File: "d.jpg"},
+				{File: "e.jpg", Error: "file not found"},
+			},
+			want: Summary{
+				Files:      5,
+				Models:     []ModelCount{{"Z 6", 2}, {"", 1}, {"X100V", 1}},
+				Unreadable: []UnreadableFile{{"e.jpg", "file not found"}},
+			},
+		},
+		{
+			name: "swap and location data",
+			reports: []Report{
+				{File: "a.jpg", Camera: "SIGMA fp", Swap: &SwapReport{Swapped: true, Model: "SIGMA fp", OriginalModel: "Z 6"}, Location: &LocationReport{HasGPS: true}},
+				{File: "b.jpg", Camera: "SIGMA fp", Swap: &SwapReport{Swapped: true, Model: "SIGMA fp", OriginalModel: "Z 6"}, Location: &LocationReport{HasPlaceNames: true}},
+				{File: "c.jpg", Camera: "X100V", Swap: &SwapReport{Model: "X100V"}, Location: &LocationReport{HasGPS: true, PrivacyZone: "home"}},
+			},
+			want: Summary{
+				Files:      3,
+				Swap:       &SwapSummary{Swapped: 2, Swaps: []SwapCount{{"Z 6", "SIGMA fp", 2}}},
+				Location:   &LocationSummary{WithGPS: 2, WithPlaceNames: 1, InPrivacyZones: 1},
+				Models:     []ModelCount{{"SIGMA fp", 2}, {"X100V", 1}},
+				Unreadable: []UnreadableFile{},
+			},
+		},
+		{
+			name:    "swap data with no swaps",
+			reports: []Report{{File: "a.jpg", Camera: "Z 6", Swap: &SwapReport{Model: "Z 6"}}},
+			want: Summary{
+				Files:      1,
+				Swap:       &SwapSummary{Swaps: []SwapCount{}},
+				Models:     []ModelCount{{"Z 6", 1}},
+				Unreadable: []UnreadableFile{},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Summarize(tc.reports); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Summarize() = %+v; want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -31,9 +31,16 @@ func main() {
 	subcommands.Register(&installCmd{}, "")
 	subcommands.Register(&camswapCmd{}, "EXIF modification")
 	subcommands.Register(&rmlocCmd{}, "EXIF modification")
+	subcommands.Register(&anonymizeCmd{}, "EXIF modification")
+	subcommands.Register(&geotagCmd{}, "EXIF modification")
+	subcommands.Register(&timeshiftCmd{}, "EXIF modification")
 	subcommands.Register(&inspectCmd{}, "EXIF inspection")
+	subcommands.Register(&auditCmd{}, "EXIF inspection")
+	subcommands.Register(&diffCmd{}, "EXIF inspection")
 	subcommands.Register(&neatImgCmd{}, "noise reduction")
+	subcommands.Register(&previewCmd{}, "RAW files")
 	subcommands.Register(&x3fJpgCmd{}, "Sigma X3F")
+	subcommands.Register(&watchCmd{}, "automation")
 
 	flag.Parse()
 
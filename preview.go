@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/google/subcommands"
+
+	"xtool/preview"
+)
+
+type previewCmd struct {
+	outDir    string
+	rotate    bool
+	verbose   bool
+	verbose2  bool
+	appConfig AppConfig
+}
+
+func (*previewCmd) Name() string { return "preview" }
+func (*previewCmd) Synopsis() string {
+	return "Extract the embedded JPEG from RAW files."
+}
+
+func (*previewCmd) Usage() string {
+	return `preview [-d out_dir] [-rotate] [-v|-vv] file1.nef [file2.cr3 ...]:
+  Extracts the largest JPEG embedded in each of the given RAW files (NEF, CR2, CR3, ARW, RAF, ORF,
+  DNG, etc.) to a file named like DSC_0001.NEF.jpg, alongside the RAW file or in out_dir, and
+  copies the RAW file's metadata to it. Existing files are not overwritten.
+  With -rotate, the JPEG is rotated per the RAW file's Orientation and re-encoded, so it displays
+  upright even in apps that ignore the Orientation tag; otherwise, the Orientation tag is copied.
+  Sigma X3F files are extracted with x3f_extract, like x3fjpg; their metadata isn't copied, and
+  -rotate doesn't apply.
+`
+}
+
+func (p *previewCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&p.outDir, "d", "", "Write extracted JPEGs to this directory.")
+	f.BoolVar(&p.rotate, "rotate", false, "Rotate extracted JPEGs per the RAW file's Orientation.")
+	f.BoolVar(&p.verbose, "v", false, "Print full x3f_extract output for each X3F image.")
+	f.BoolVar(&p.verbose2, "vv", false, "Print exiftool and x3f_extract commands, and full x3f_extract output.")
+}
+
+func (p *previewCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if p.verbose2 {
+		p.verbose = true
+	}
+
+	if len(f.Args()) == 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	var x3fFiles, rawFiles []string
+	for _, imgFilename := range f.Args() {
+		if strings.EqualFold(filepath.Ext(imgFilename), ".x3f") {
+			x3fFiles = append(x3fFiles, imgFilename)
+		} else {
+			rawFiles = append(rawFiles, imgFilename)
+		}
+	}
+
+	p.appConfig = AppConfigFromCtx(ctx)
+
+	if p.outDir != "" {
+		// prep output directory:
+		err := os.MkdirAll(p.outDir, 0777)
+		if err != nil {
+			ErrPrintf(ctx, "failed to ensure '%s' exists: %s\n", p.outDir, err)
+			return subcommands.ExitFailure
+		}
+	}
+
+	var successes []string
+	failures := make(map[string]error)
+
+	if len(rawFiles) != 0 {
+		et, err := newExiftool(p.appConfig, p.verbose2)
+		if err != nil {
+			ErrPrint(ctx, err)
+			return subcommands.ExitFailure
+		}
+		//goland:noinspection GoUnhandledErrorResult
+		defer func() { _ = et.Close() }()
+
+		errorPrintln := color.New(color.FgRed).PrintlnFunc()
+		opts := preview.Options{OutDir: p.outDir, Rotate: p.rotate}
+		for _, imgFilename := range rawFiles {
+			fmt.Printf("%s ...\n", imgFilename)
+			result, err := preview.Extract(ctx, et, imgFilename, opts)
+			if err != nil {
+				failures[imgFilename] = err
+				errorPrintln(err.Error())
+				continue
+			}
+			fmt.Printf("%s %s (%dx%d)\n", color.MagentaString("%s:", result.Tag), result.Path, result.Width, result.Height)
+			successes = append(successes, imgFilename)
+		}
+	}
+
+	if len(x3fFiles) != 0 {
+		if !findX3fExtract(ctx, &p.appConfig) {
+			return subcommands.ExitFailure
+		}
+		x3fSuccesses, x3fFailures := X3fJpgProcess(
+			x3fJpgArgs(p.outDir, p.verbose, p.verbose2),
+			x3fFiles,
+			p.appConfig,
+			p.verbose,
+			p.verbose2,
+		)
+		successes = append(successes, x3fSuccesses...)
+		for filename, err := range x3fFailures {
+			failures[filename] = err
+		}
+	}
+
+	boldWhitePrintf := color.New(color.Bold, color.FgWhite).PrintfFunc()
+	boldRedPrintf := color.New(color.Bold, color.FgRed).PrintfFunc()
+
+	boldWhitePrintf("\npreview: successfully extracted %d images.\n", len(successes))
+
+	if len(failures) != 0 {
+		boldRedPrintf("Errors:\n")
+		for filename, err := range failures {
+			fmt.Printf("- %s %s\n", color.MagentaString("%s:", filename), err)
+		}
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,183 @@
+// Package preview extracts the largest JPEG embedded in a RAW file, such as the full-size JPEG
+// many cameras embed for display, as a standalone JPEG carrying the RAW file's metadata.
+package preview
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"xtool/exif"
+	"xtool/rmloc"
+)
+
+// rotatedQuality is the JPEG quality a rotated preview is re-encoded with.
+const rotatedQuality = 95
+
+// ErrNoPreview is returned by Extract for a file with no embedded JPEG.
+var ErrNoPreview = errors.New("no embedded JPEG found")
+
+// Options control how Extract writes previews.
+type Options struct {
+	OutDir string // if set, write previews to this directory rather than alongside the RAW files
+	Rotate bool   // rotate the preview's pixels per the RAW file's Orientation, rather than copying the Orientation tag
+}
+
+// Result describes an extracted preview.
+type Result struct {
+	Path   string // where the preview was written
+	Tag    string // the tag it was extracted from: PreviewImage, JpgFromRaw, etc.
+	Width  int
+	Height int
+}
+
+// OutputPath returns the path Extract writes file's preview to: file's name, with .jpg appended
+// (eg. DSC_0001.NEF.jpg), like x3f_extract's.
+func OutputPath(file string, opts Options) string {
+	if opts.OutDir != "" {
+		return filepath.Join(opts.OutDir, filepath.Base(file)+".jpg")
+	}
+	return file + ".jpg"
+}
+
+// Extract writes the largest JPEG embedded in file to OutputPath, and copies file's metadata to
+// it, except for the embedded images themselves. It doesn't overwrite an existing file.
+func Extract(ctx context.Context, et *exif.Exiftool, file string, opts Options) (Result, error) {
+	out := OutputPath(file, opts)
+
+	args := []string{"-n", "-Orientation"}
+	for _, tag := range rmloc.PreviewTags {
+		args = append(args, "-"+tag)
+	}
+	result, err := et.ReadJSON(ctx, args, file)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(result) != 1 {
+		return Result{}, fmt.Errorf("invalid exiftool output: expected 1 item, got %d", len(result))
+	}
+
+	var r Result
+	var data []byte
+	for _, tag := range rmloc.PreviewTags {
+		if _, ok := result[0][tag]; !ok {
+			continue
+		}
+		candidate, err := et.ExtractBinary(ctx, tag, file)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to extract %s: %w", tag, err)
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(candidate))
+		if err != nil {
+			continue // not a JPEG; some formats embed TIFF or raw previews
+		}
+		if cfg.Width*cfg.Height > r.Width*r.Height {
+			r, data = Result{Path: out, Tag: tag, Width: cfg.Width, Height: cfg.Height}, candidate
+		}
+	}
+	if data == nil {
+		return Result{}, ErrNoPreview
+	}
+
+	orientation := 1
+	if o, ok := result[0]["Orientation"].(float64); ok {
+		orientation = int(o)
+	}
+	rotate := opts.Rotate && orientation > 1 && orientation <= 8
+	if rotate {
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to decode %s: %w", r.Tag, err)
+		}
+		rotated := orient(img, orientation)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, rotated, &jpeg.Options{Quality: rotatedQuality}); err != nil {
+			return Result{}, fmt.Errorf("failed to encode rotated %s: %w", r.Tag, err)
+		}
+		data = buf.Bytes()
+		r.Width, r.Height = rotated.Bounds().Dx(), rotated.Bounds().Dy()
+	}
+
+	if err := writeNew(out, data); err != nil {
+		return Result{}, err
+	}
+
+	// copy the RAW's metadata, except for its embedded images and the RAW image's dimensions:
+	copyArgs := []string{"-overwrite_original", "-tagsFromFile", file, "-all:all", "--ExifImageWidth", "--ExifImageHeight"}
+	for _, tag := range rmloc.PreviewTags {
+		copyArgs = append(copyArgs, "--"+tag)
+	}
+	if rotate {
+		copyArgs = append(copyArgs, "--Orientation", "-Orientation#=1")
+	}
+	if _, err := et.Run(ctx, append(copyArgs, out)...); err != nil {
+		_ = os.Remove(out)
+		return Result{}, fmt.Errorf("failed to copy metadata: %w", err)
+	}
+	return r, nil
+}
+
+// writeNew writes data to a new file at path, failing if path already exists.
+func writeNew(path string, data []byte) error {
+	// O_EXCL makes checking for an existing file and creating the new one a single step, so a
+	// file created at path since Extract started is never overwritten:
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("'%s' already exists", path)
+	} else if err != nil {
+		return fmt.Errorf("failed to create '%s': %w", path, err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to write '%s': %w", path, err)
+	}
+	return nil
+}
+
+// orient returns img transformed per the given EXIF Orientation, so it displays upright without
+// an Orientation tag.
+func orient(img image.Image, orientation int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// orientations 5-8 swap the image's width and height:
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored horizontally, then rotated 270° clockwise
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // mirrored horizontally, then rotated 90° clockwise
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 270° clockwise
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
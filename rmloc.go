@@ -4,32 +4,78 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"os"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/google/subcommands"
+
+	"xtool/exif"
+	"xtool/rmloc"
+	"xtool/stash"
 )
 
 type rmlocCmd struct {
-	suffix    bool
-	outDir    string
-	verbose   bool
-	verbose2  bool
-	appConfig AppConfig
+	suffix         bool
+	outDir         string
+	verify         bool
+	coarsen        float64
+	precision      string
+	zones          bool
+	deep           bool
+	regenPreviews  bool
+	stash          bool
+	encrypt        bool
+	passphraseFile string
+	restore        bool
+	verbose        bool
+	verbose2       bool
+	appConfig      AppConfig
 }
 
 func (*rmlocCmd) Name() string     { return "rmloc" }
 func (*rmlocCmd) Synopsis() string { return "Remove all GPS metadata." }
 
 func (*rmlocCmd) Usage() string {
-	return `rmloc [-s] [-d out_dir] [-v|-vv] file1.jpg [file2.nef ...]:
+	return `rmloc [-deep [-regen-previews]] [-zones] [-coarsen DEGREES|-precision neighborhood|city|region] [-stash [-encrypt] [-passphrase-file FILE]] [-s] [-d out_dir] [-verify] [-v|-vv] file1.jpg [file2.nef ...]
+rmloc -r [-passphrase-file FILE] [-s] [-d out_dir] [-v|-vv] file1.jpg [file2.nef ...]:
   Removes all GPS data from the given files.
+  With -deep, also removes place names (IPTC & XMP city, sub-location, state and country,
+  Iptc4xmpCore:Location, Apple & Google location fields, and maker note place names), and location
+  metadata embedded in preview images and thumbnails. With -regen-previews, a JPEG's embedded
+  previews and thumbnails are instead replaced with ones downscaled from the image itself, with no
+  metadata, so they can't show content cropped or edited out of the image either; other files'
+  previews are only cleaned. exiftool can't replace previews in some formats (eg. CR3, RAF, HEIC);
+  location metadata left in those is reported as a warning. inspect -previews lists a file's
+  embedded images.
+  With -coarsen or -precision, the location is instead rounded to a grid of the given size, in
+  degrees, so it reveals only the approximate area; altitude, direction, timestamps and all other
+  GPS tags are still removed. Files without a location are skipped.
+  With -zones, only files located inside one of the privacy_zones defined in config have their
+  location removed (or coarsened); other files are skipped.
+  With -stash, the removed location is stashed in a sidecar file (named like photo.jpg` + rmloc.SidecarSuffix + `),
+  or with -encrypt, in an XMP attribute encrypted with a passphrase, read from the passphrase file
+  or the ` + stash.PassphraseEnvVar + ` environment variable. -r restores a stashed location; an
+  encrypted location requires the same passphrase. With -s or -d, -stash requires -encrypt: a
+  sidecar would otherwise put the original location right next to the copy meant to be shared.
+  With -verify, each modified file is re-read to check no GPS tags (other than a coarsened
+  location) remain in any group, nor any place names with -deep; a file that fails this check is
+  restored from its backup and reported as an error.
 `
 }
 
 func (p *rmlocCmd) SetFlags(f *flag.FlagSet) {
-	f.BoolVar(&p.suffix, "s", false, "Write modified images to new files named with the suffix _noGPS, rather than to the originals.")
+	f.BoolVar(&p.suffix, "s", false, "Write modified images to new files named with the suffix _noGPS (_coarseGPS with -coarsen or -precision, or _relocated with -r), rather than to the originals.")
 	f.StringVar(&p.outDir, "d", "", "Write modified images to this directory.")
+	f.Float64Var(&p.coarsen, "coarsen", 0, "Round the location to a grid of this many degrees, rather than removing it.")
+	f.StringVar(&p.precision, "precision", "", "Round the location to a named grid (neighborhood: 0.01°, city: 0.1°, region: 1°), rather than removing it.")
+	f.BoolVar(&p.deep, "deep", false, "Also remove place names, and location metadata embedded in previews and thumbnails.")
+	f.BoolVar(&p.regenPreviews, "regen-previews", false, "With -deep, replace JPEGs' embedded previews and thumbnails with ones made from the image itself.")
+	f.BoolVar(&p.zones, "zones", false, "Only remove (or coarsen) locations inside a privacy zone defined in privacy_zones.")
+	f.BoolVar(&p.stash, "stash", false, "Stash the removed location in a sidecar file, so it can be restored with -r.")
+	f.BoolVar(&p.encrypt, "encrypt", false, "With -stash, stash the removed location in an encrypted XMP attribute rather than a sidecar file.")
+	f.StringVar(&p.passphraseFile, "passphrase-file", "", "Read the passphrase from this file, rather than from $"+stash.PassphraseEnvVar+".")
+	f.BoolVar(&p.restore, "r", false, "Restore the location stashed by -stash.")
+	f.BoolVar(&p.verify, "verify", false, "Re-read each modified image and check no GPS tags remain; revert it if any do.")
 	f.BoolVar(&p.verbose, "v", false, "Print full exiftool output for each image.")
 	f.BoolVar(&p.verbose2, "vv", false, "Print exiftool commands and full exiftool output.")
 }
@@ -39,35 +85,91 @@ func (p *rmlocCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{
 		p.verbose = true
 	}
 
-	if len(f.Args()) == 0 {
+	removeOptionGiven := p.coarsen != 0 || p.precision != "" || p.deep || p.zones || p.stash || p.verify
+	if len(f.Args()) == 0 || p.coarsen < 0 || (p.coarsen != 0 && p.precision != "") ||
+		(p.encrypt && !p.stash) || (p.stash && !p.encrypt && (p.suffix || p.outDir != "")) || (p.regenPreviews && !p.deep) || (p.restore && removeOptionGiven) {
 		f.Usage()
 		return subcommands.ExitUsageError
 	}
+	if p.precision != "" {
+		grid, ok := rmloc.Precisions[p.precision]
+		if !ok {
+			ErrPrintf(ctx, "unknown precision '%s'\n", p.precision)
+			return subcommands.ExitUsageError
+		}
+		p.coarsen = grid
+	}
 
 	p.appConfig = AppConfigFromCtx(ctx)
 
-	exiftoolArgs := []string{"-gps*="}
-	if p.outDir != "" && p.suffix {
-		exiftoolArgs = append(exiftoolArgs, "-o", fmt.Sprintf("%s%s%%f_noGPS.%%e", p.outDir, string(os.PathSeparator)))
-	} else if p.suffix {
-		exiftoolArgs = append(exiftoolArgs, "-o", "%d%f_noGPS.%e")
-	} else if p.outDir != "" {
-		exiftoolArgs = append(exiftoolArgs, "-o", fmt.Sprintf("%s%s", p.outDir, string(os.PathSeparator)))
+	passphrase := ""
+	if p.encrypt || p.restore {
+		var err error
+		if passphrase, err = stash.Passphrase(p.passphraseFile); err != nil {
+			ErrPrint(ctx, err)
+			return subcommands.ExitFailure
+		}
+		if p.encrypt && passphrase == "" {
+			ErrPrintln(ctx, stash.ErrNoPassphrase.Error())
+			return subcommands.ExitFailure
+		}
+	}
+
+	if p.zones && len(p.appConfig.PrivacyZones) == 0 {
+		ErrPrintln(ctx, "rmloc -zones requires zones defined in privacy_zones")
+		return subcommands.ExitFailure
 	}
 
-	successes, failures := ExiftoolProcess(
-		ctx,
-		exiftoolArgs,
-		f.Args(),
-		p.appConfig,
-		p.verbose,
-		p.verbose2,
-	)
+	et, err := newExiftool(p.appConfig, p.verbose2)
+	if err != nil {
+		ErrPrint(ctx, err)
+		return subcommands.ExitFailure
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer func() { _ = et.Close() }()
+
+	opts := rmloc.Options{Output: exif.Output{Dir: p.outDir, Suffix: p.suffix}, Coarsen: p.coarsen, Deep: p.deep, RegeneratePreviews: p.regenPreviews, Verify: p.verify}
+	if p.stash {
+		opts.Stash = rmloc.StashSidecar
+		if p.encrypt {
+			opts.Stash = rmloc.StashXMP
+			opts.Passphrase = passphrase
+		}
+	}
+	process := func(imgFilename string, startTime time.Time) exif.Result {
+		return rmloc.Remove(ctx, et, imgFilename, opts, startTime)
+	}
+	if p.restore {
+		process = func(imgFilename string, startTime time.Time) exif.Result {
+			return rmloc.Restore(ctx, et, imgFilename, opts.Output, passphrase, startTime)
+		}
+	} else if p.zones {
+		process = func(imgFilename string, startTime time.Time) exif.Result {
+			loc, ok, err := rmloc.ReadLocation(ctx, et, imgFilename)
+			if err != nil {
+				return exif.Result{File: imgFilename, Err: err}
+			}
+			if !ok {
+				return exif.Result{File: imgFilename, SkipReason: "no GPS location"}
+			}
+			zone, ok := rmloc.ZoneContaining(p.appConfig.PrivacyZones, loc)
+			if !ok {
+				return exif.Result{File: imgFilename, SkipReason: "not inside a privacy zone"}
+			}
+			fmt.Printf("inside privacy zone %s\n", color.MagentaString(zone.Name))
+			return rmloc.RemoveFrom(ctx, et, imgFilename, &loc, opts, startTime)
+		}
+	}
+
+	successes, failures := ExiftoolProcess(ctx, f.Args(), p.verbose, p.verbose2, process)
 
 	boldWhitePrintf := color.New(color.Bold, color.FgWhite).PrintfFunc()
 	boldRedPrintf := color.New(color.Bold, color.FgRed).PrintfFunc()
 
 	boldWhitePrintf("\nrmloc: successfully processed %d images.\n", len(successes))
+	if skipped := len(f.Args()) - len(successes) - len(failures); skipped > 0 {
+		boldWhitePrintf("rmloc: skipped %d images.\n", skipped)
+	}
 
 	if len(failures) != 0 {
 		boldRedPrintf("Errors:\n")
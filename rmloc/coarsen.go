@@ -0,0 +1,140 @@
+package rmloc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"xtool/exif"
+)
+
+// Precisions are the named grid sizes, in degrees, a location may be coarsened to.
+// A degree of latitude is about 111 km.
+var Precisions = map[string]float64{
+	"neighborhood": 0.01,
+	"city":         0.1,
+	"region":       1,
+}
+
+// Location is a position in signed decimal degrees.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// ReadLocation reads file's GPS location. It reports false if the file has no location.
+func ReadLocation(ctx context.Context, et *exif.Exiftool, file string) (Location, bool, error) {
+	// the Composite tags combine each coordinate with its Ref, giving signed values:
+	result, err := et.ReadJSON(ctx, []string{"-n", "-Composite:GPSLatitude", "-Composite:GPSLongitude"}, file)
+	if err != nil {
+		return Location{}, false, err
+	}
+	if len(result) != 1 {
+		return Location{}, false, fmt.Errorf("invalid exiftool output: expected 1 item, got %d", len(result))
+	}
+	lat, latOK := result[0]["GPSLatitude"].(float64)
+	lon, lonOK := result[0]["GPSLongitude"].(float64)
+	if !latOK || !lonOK {
+		return Location{}, false, nil
+	}
+	return Location{Latitude: lat, Longitude: lon}, true, nil
+}
+
+// LocationFromMetadata returns the location given by the Composite:GPSPosition tag in metadata
+// read with -gps* (as from LocationArgs), in either exiftool's default degrees-minutes-seconds
+// format or, read with -n, signed decimal degrees. It reports false if there is no location.
+func LocationFromMetadata(m exif.Metadata) (Location, bool) {
+	position, ok := m.String("GPSPosition")
+	if !ok {
+		return Location{}, false
+	}
+	if match := dmsPositionRegexp.FindStringSubmatch(position); match != nil {
+		return Location{
+			Latitude:  dmsDegrees(match[1], match[2], match[3], match[4]),
+			Longitude: dmsDegrees(match[5], match[6], match[7], match[8]),
+		}, true
+	}
+	fields := strings.Fields(position)
+	if len(fields) != 2 {
+		return Location{}, false
+	}
+	lat, latErr := strconv.ParseFloat(fields[0], 64)
+	lon, lonErr := strconv.ParseFloat(fields[1], 64)
+	if latErr != nil || lonErr != nil {
+		return Location{}, false
+	}
+	return Location{Latitude: lat, Longitude: lon}, true
+}
+
+// dmsPositionRegexp matches exiftool's default GPSPosition format, eg. 42 deg 16' 52.43" N, 83 deg 44' 34.00" W
+var dmsPositionRegexp = regexp.MustCompile(`^([\d.]+) deg ([\d.]+)' ([\d.]+)" ([NS]), ([\d.]+) deg ([\d.]+)' ([\d.]+)" ([EW])$`)
+
+func dmsDegrees(deg, min, sec, ref string) float64 {
+	d, _ := strconv.ParseFloat(deg, 64)
+	m, _ := strconv.ParseFloat(min, 64)
+	s, _ := strconv.ParseFloat(sec, 64)
+	degrees := d + m/60 + s/3600
+	if ref == "S" || ref == "W" {
+		degrees = -degrees
+	}
+	// seconds are reported to 2 decimal places, so round away the spurious precision of the conversion:
+	degrees, _ = strconv.ParseFloat(strconv.FormatFloat(degrees, 'f', 6, 64), 64)
+	return degrees
+}
+
+// Coarsen rounds loc to a grid of the given size, in degrees.
+func (loc Location) Coarsen(grid float64) Location {
+	return Location{
+		Latitude:  roundToGrid(loc.Latitude, grid, 90),
+		Longitude: roundToGrid(loc.Longitude, grid, 180),
+	}
+}
+
+// roundToGrid rounds degrees to the nearest multiple of grid whose magnitude doesn't exceed limit.
+func roundToGrid(degrees, grid, limit float64) float64 {
+	steps := math.Round(degrees / grid)
+	// near the poles or the antimeridian, the nearest multiple may be out of range (eg. 88 on a 7° grid
+	// rounds to 91), so use the next one towards zero instead:
+	if math.Abs(steps*grid) > limit+1e-9 {
+		steps -= math.Copysign(1, steps)
+	}
+	rounded := steps * grid
+	// trim the floating point noise multiplying by grid introduces (eg. 42.300000000000004):
+	rounded, _ = strconv.ParseFloat(strconv.FormatFloat(rounded, 'f', 6, 64), 64)
+	if rounded == 0 {
+		return 0 // not -0, which would be written as "-0"
+	}
+	return rounded
+}
+
+// CoarsenArgs returns the exiftool arguments that replace a file's GPS tags with loc rounded to
+// a grid of the given size, in degrees. Every other GPS tag (altitude, direction, timestamps, etc.)
+// is removed. The grid size is recorded in xtool's XMP attributes.
+func CoarsenArgs(loc Location, grid float64, out exif.Output) []string {
+	coarse := loc.Coarsen(grid)
+	latRef, lonRef := "N", "E"
+	if coarse.Latitude < 0 {
+		latRef = "S"
+	}
+	if coarse.Longitude < 0 {
+		lonRef = "W"
+	}
+
+	exiftoolArgs := []string{
+		"-gps*=",
+		// EXIF stores the coordinates unsigned, with a Ref; XMP stores them signed:
+		"-GPSLatitude=" + formatDegrees(coarse.Latitude),
+		"-GPSLatitudeRef=" + latRef,
+		"-GPSLongitude=" + formatDegrees(coarse.Longitude),
+		"-GPSLongitudeRef=" + lonRef,
+		"-" + exif.TagLocationPrecision + "=" + formatDegrees(grid),
+	}
+	return append(exiftoolArgs, out.Args("coarseGPS")...)
+}
+
+func formatDegrees(degrees float64) string {
+	return strconv.FormatFloat(degrees, 'f', -1, 64)
+}
@@ -0,0 +1,94 @@
+package rmloc
+
+import (
+	"slices"
+	"testing"
+
+	"xtool/exif"
+)
+
+func TestCoarsen(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		loc  Location
+		grid float64
+		want Location
+	}{
+		{"neighborhood", Location{42.28083, -83.74302}, 0.01, Location{42.28, -83.74}},
+		{"city", Location{42.28083, -83.74302}, 0.1, Location{42.3, -83.7}},
+		{"region", Location{42.28083, -83.74302}, 1, Location{42, -84}},
+		{"southern and eastern hemispheres", Location{-33.86785, 151.20732}, 0.1, Location{-33.9, 151.2}},
+		{"rounds half away from zero", Location{0.05, -0.05}, 0.1, Location{0.1, -0.1}},
+		{"odd grid", Location{42.28083, -83.74302}, 0.25, Location{42.25, -83.75}},
+		{"near the north pole", Location{89.97, 10}, 0.1, Location{90, 10}},
+		{"near the south pole", Location{-89.97, 10}, 0.1, Location{-90, 10}},
+		{"at the antimeridian, east", Location{0, 179.97}, 0.1, Location{0, 180}},
+		{"at the antimeridian, west", Location{0, -179.97}, 0.1, Location{0, -180}},
+		{"grid past the north pole", Location{88, 0}, 7, Location{84, 0}},
+		{"grid past the south pole", Location{-88, 0}, 7, Location{-84, 0}},
+		{"grid past the antimeridian, east", Location{0, 179}, 7, Location{0, 175}},
+		{"grid past the antimeridian, west", Location{0, -179}, 7, Location{0, -175}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.loc.Coarsen(tc.grid)
+			if got != tc.want {
+				t.Errorf("Coarsen(%v) = %v; want %v", tc.grid, got, tc.want)
+			}
+			if !onGrid(got.Latitude, tc.grid) || !onGrid(got.Longitude, tc.grid) {
+				t.Errorf("Coarsen(%v) = %v; not on the grid", tc.grid, got)
+			}
+		})
+	}
+}
+
+func TestCoarsenArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		loc  Location
+		grid float64
+		out  exif.Output
+		want []string
+	}{
+		{
+			name: "north and west",
+			loc:  Location{42.28083, -83.74302},
+			grid: Precisions["city"],
+			want: []string{
+				"-gps*=",
+				"-GPSLatitude=42.3", "-GPSLatitudeRef=N",
+				"-GPSLongitude=-83.7", "-GPSLongitudeRef=W",
+				"-" + exif.TagLocationPrecision + "=0.1",
+			},
+		},
+		{
+			name: "south and east, to a new file",
+			loc:  Location{-33.86785, 151.20732},
+			grid: Precisions["neighborhood"],
+			out:  exif.Output{Suffix: true},
+			want: []string{
+				"-gps*=",
+				"-GPSLatitude=-33.87", "-GPSLatitudeRef=S",
+				"-GPSLongitude=151.21", "-GPSLongitudeRef=E",
+				"-" + exif.TagLocationPrecision + "=0.01",
+				"-o", "%d%f_coarseGPS.%e",
+			},
+		},
+		{
+			name: "rounded onto the equator and prime meridian",
+			loc:  Location{-0.4, -0.4},
+			grid: Precisions["region"],
+			want: []string{
+				"-gps*=",
+				"-GPSLatitude=0", "-GPSLatitudeRef=N",
+				"-GPSLongitude=0", "-GPSLongitudeRef=E",
+				"-" + exif.TagLocationPrecision + "=1",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := CoarsenArgs(tc.loc, tc.grid, tc.out); !slices.Equal(got, tc.want) {
+				t.Errorf("CoarsenArgs() = %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package rmloc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"xtool/exif"
+)
+
+// regeneratedPreviewQuality is the JPEG quality regeneratePreviews encodes previews with.
+const regeneratedPreviewQuality = 85
+
+// DeepTags are the non-GPS tags that reveal where an image was made: IPTC & XMP place names
+// (including photoshop:City and Iptc4xmpCore:Location), IPTC Extension location structures,
+// Apple & Google location fields, and maker note place names. Wildcards are supported.
+var DeepTags = []string{
+	"City", "City2", "Sub-location", "Province-State", "State", "Country*",
+	"Location*", // Iptc4xmpCore:Location, LocationCreated/LocationShown, Apple's LocationName, etc.
+	"Landmark", "TimeZoneCity",
+}
+
+// PreviewTags are the tags embedded preview images and thumbnails are stored in. Previews
+// often carry their own copy of the image's metadata.
+var PreviewTags = []string{"ThumbnailImage", "PreviewImage", "JpgFromRaw", "OtherImage"}
+
+// previewWritableFileTypes are the file types, as reported by exiftool's FileType tag, that
+// exiftool can replace embedded previews in: those with a TIFF structure, plus Canon's CRW.
+// Previews in other formats, such as CR3, RAF, and HEIC, can only be read.
+var previewWritableFileTypes = map[string]bool{
+	"JPEG": true, "TIFF": true, "DNG": true, "CRW": true, "CR2": true, "NEF": true, "NRW": true,
+	"ARW": true, "SR2": true, "SRF": true, "ORF": true, "PEF": true, "RW2": true, "RWL": true,
+	"SRW": true, "ERF": true, "3FR": true, "IIQ": true, "MEF": true, "MOS": true, "DCR": true,
+	"KDC": true, "MRW": true,
+}
+
+// LocationArgs returns the exiftool arguments that read every tag that may reveal a file's
+// location; with deep, this includes DeepTags.
+func LocationArgs(deep bool) []string {
+	args := []string{"-gps*"}
+	if deep {
+		for _, tag := range DeepTags {
+			args = append(args, "-"+tag)
+		}
+	}
+	return args
+}
+
+// deepArgs returns the exiftool arguments that remove DeepTags.
+func deepArgs() []string {
+	args := make([]string, 0, len(DeepTags))
+	for _, tag := range DeepTags {
+		args = append(args, "-"+tag+"=")
+	}
+	return args
+}
+
+// scrubPreviews extracts each preview image embedded in file which has location metadata of its
+// own into tmpDir, removes that metadata from it, and returns the exiftool arguments that
+// replace the embedded preview with the scrubbed copy. Previews with location metadata that
+// exiftool can't write in file's format are left unchanged, and described by the returned warning.
+func scrubPreviews(ctx context.Context, et *exif.Exiftool, file string, tmpDir string) (exiftoolArgs []string, warning error, err error) {
+	previews, fileType, err := extractPreviews(ctx, et, file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unwritable []string
+	for _, tag := range PreviewTags {
+		preview, ok := previews[tag]
+		if !ok {
+			continue
+		}
+		previewFile := filepath.Join(tmpDir, tag+".jpg")
+		if err := os.WriteFile(previewFile, preview, 0o600); err != nil {
+			return nil, nil, fmt.Errorf("failed to write %s to '%s': %w", tag, previewFile, err)
+		}
+
+		previewLocation, err := et.ReadJSON(ctx, LocationArgs(true), previewFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s metadata: %w", tag, err)
+		}
+		if len(previewLocation) != 1 || !hasLocation(previewLocation[0]) {
+			continue
+		}
+		if !previewWritableFileTypes[fileType] {
+			unwritable = append(unwritable, tag)
+			continue
+		}
+		scrubArgs := append(append([]string{"-overwrite_original", "-gps*="}, deepArgs()...), previewFile)
+		if _, err := et.Run(ctx, scrubArgs...); err != nil {
+			return nil, nil, fmt.Errorf("failed to remove location from %s: %w", tag, err)
+		}
+		exiftoolArgs = append(exiftoolArgs, "-"+tag+"<="+previewFile)
+	}
+	if len(unwritable) != 0 {
+		warning = fmt.Errorf("location metadata left in embedded %s: exiftool can't replace previews in %s files",
+			strings.Join(unwritable, ", "), fileType)
+	}
+	return exiftoolArgs, warning, nil
+}
+
+// regeneratePreviews replaces each preview image embedded in file with one downscaled from
+// file's own image, at the preview's size, returning the exiftool arguments that write them. The
+// new previews carry no metadata, and show exactly what the image does, so they can't leak a
+// location, or content cropped or edited out of the image. Only JPEG files can be decoded, so for
+// other files it reports false, and the caller should fall back to scrubPreviews.
+func regeneratePreviews(ctx context.Context, et *exif.Exiftool, file string, tmpDir string) ([]string, bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, false, err
+	}
+	img, err := jpeg.Decode(f)
+	_ = f.Close()
+	if err != nil {
+		return nil, false, nil
+	}
+
+	previews, _, err := extractPreviews(ctx, et, file)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var exiftoolArgs []string
+	for _, tag := range PreviewTags {
+		preview, ok := previews[tag]
+		if !ok {
+			continue
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(preview))
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read %s dimensions: %w", tag, err)
+		}
+
+		// fit the image within the preview's bounds; its aspect ratio may differ if the image has
+		// been cropped since the preview was made:
+		bounds := img.Bounds()
+		scale := min(float64(cfg.Width)/float64(bounds.Dx()), float64(cfg.Height)/float64(bounds.Dy()), 1)
+		width, height := max(int(float64(bounds.Dx())*scale), 1), max(int(float64(bounds.Dy())*scale), 1)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, downscale(img, width, height), &jpeg.Options{Quality: regeneratedPreviewQuality}); err != nil {
+			return nil, false, fmt.Errorf("failed to encode %s: %w", tag, err)
+		}
+		previewFile := filepath.Join(tmpDir, tag+".jpg")
+		if err := os.WriteFile(previewFile, buf.Bytes(), 0o600); err != nil {
+			return nil, false, fmt.Errorf("failed to write %s to '%s': %w", tag, previewFile, err)
+		}
+		exiftoolArgs = append(exiftoolArgs, "-"+tag+"<="+previewFile)
+	}
+	return exiftoolArgs, true, nil
+}
+
+// extractPreviews returns each preview image embedded in file, by tag, and file's type, as
+// reported by exiftool's FileType tag.
+func extractPreviews(ctx context.Context, et *exif.Exiftool, file string) (map[string][]byte, string, error) {
+	previewArgs := []string{"-FileType"}
+	for _, tag := range PreviewTags {
+		previewArgs = append(previewArgs, "-"+tag)
+	}
+	result, err := et.ReadJSON(ctx, previewArgs, file)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(result) != 1 {
+		return nil, "", fmt.Errorf("invalid exiftool output: expected 1 item, got %d", len(result))
+	}
+	fileType, _ := result[0].String("FileType")
+
+	previews := make(map[string][]byte)
+	for _, tag := range PreviewTags {
+		if _, ok := result[0][tag]; !ok {
+			continue
+		}
+		preview, err := et.ExtractBinary(ctx, tag, file)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to extract %s: %w", tag, err)
+		}
+		if len(preview) != 0 {
+			previews[tag] = preview
+		}
+	}
+	return previews, fileType, nil
+}
+
+// downscale resizes img to width x height by averaging the source pixels each destination pixel
+// covers.
+func downscale(img image.Image, width, height int) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/width, x0+1)
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, _ := img.At(sx, sy).RGBA()
+					r, g, b, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), n+1
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n>>8), uint8(g/n>>8), uint8(b/n>>8), 0xff
+		}
+	}
+	return dst
+}
+
+// hasLocation reports whether m, read with LocationArgs, includes any location tags.
+func hasLocation(m exif.Metadata) bool {
+	for key := range m {
+		if key != "SourceFile" && exif.TagName(key) != "GPSVersionID" {
+			return true
+		}
+	}
+	return false
+}
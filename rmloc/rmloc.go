@@ -0,0 +1,153 @@
+// Package rmloc removes location metadata from images, or coarsens it so that it only reveals
+// the approximate area an image was made in.
+package rmloc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"xtool/exif"
+)
+
+// Args returns the exiftool arguments that remove all GPS tags from a file.
+func Args(out exif.Output) []string {
+	exiftoolArgs := []string{"-gps*=", "-" + exif.TagLocationPrecision + "="}
+	return append(exiftoolArgs, out.Args("noGPS")...)
+}
+
+// Options control how Remove writes its changes.
+type Options struct {
+	Output             exif.Output
+	Coarsen            float64   // if set, round the location to a grid of this many degrees rather than removing it (see CoarsenArgs)
+	Deep               bool      // also remove DeepTags, and location metadata embedded in preview images
+	RegeneratePreviews bool      // with Deep, replace JPEG files' preview images with ones downscaled from the image, rather than only removing their location metadata
+	Stash              StashMode // where to stash the removed location tags, so Restore can put them back
+	Passphrase         string    // if set, the stash is encrypted with this passphrase; required for StashXMP
+	Verify             bool      // re-read the modified file and check no GPS tags (other than a coarsened location) remain; if any do, revert the change and fail
+}
+
+// Remove removes all GPS tags from file, or coarsens its location if opts.Coarsen is set.
+// A file without a location to coarsen is skipped. See exif.Exiftool.ProcessFile for how backups are handled.
+func Remove(ctx context.Context, et *exif.Exiftool, file string, opts Options, startTime time.Time) exif.Result {
+	var loc *Location
+	if opts.Coarsen > 0 {
+		l, ok, err := ReadLocation(ctx, et, file)
+		if err != nil {
+			return exif.Result{File: file, Err: err}
+		}
+		if !ok {
+			return exif.Result{File: file, SkipReason: "no GPS location to coarsen"}
+		}
+		loc = &l
+	}
+	return RemoveFrom(ctx, et, file, loc, opts, startTime)
+}
+
+// RemoveFrom is Remove for a file whose location has already been read. loc may be nil if
+// opts.Coarsen is not set.
+func RemoveFrom(ctx context.Context, et *exif.Exiftool, file string, loc *Location, opts Options, startTime time.Time) exif.Result {
+	exiftoolArgs := Args(opts.Output)
+	if opts.Coarsen > 0 {
+		exiftoolArgs = CoarsenArgs(*loc, opts.Coarsen, opts.Output)
+	}
+	var previewWarning error
+	if opts.Deep {
+		tmpDir, err := os.MkdirTemp("", "xtool_rmloc")
+		if err != nil {
+			return exif.Result{File: file, Err: fmt.Errorf("failed to create temporary directory: %w", err)}
+		}
+		//goland:noinspection GoUnhandledErrorResult
+		defer func() { _ = os.RemoveAll(tmpDir) }()
+
+		var previewArgs []string
+		regenerated := false
+		if opts.RegeneratePreviews {
+			if previewArgs, regenerated, err = regeneratePreviews(ctx, et, file, tmpDir); err != nil {
+				return exif.Result{File: file, Err: err}
+			}
+		}
+		if !regenerated {
+			if previewArgs, previewWarning, err = scrubPreviews(ctx, et, file, tmpDir); err != nil {
+				return exif.Result{File: file, Err: err}
+			}
+		}
+		exiftoolArgs = append(append(exiftoolArgs, deepArgs()...), previewArgs...)
+	}
+	var sidecar []byte
+	if opts.Stash != StashNone {
+		xmpArgs, encoded, err := stashArgs(ctx, et, file, opts)
+		if err != nil {
+			return exif.Result{File: file, Err: err}
+		}
+		exiftoolArgs = append(exiftoolArgs, xmpArgs...)
+		sidecar = encoded
+	}
+
+	res := et.ProcessFile(ctx, exiftoolArgs, file, startTime)
+	if opts.Verify {
+		res = exif.Verify(ctx, res, func(ctx context.Context, path string) error {
+			return Verify(ctx, et, path, opts.Coarsen, opts.Deep)
+		})
+	}
+	if res.Err == nil && previewWarning != nil {
+		res.Warning = errors.Join(res.Warning, previewWarning)
+	}
+	if res.Err == nil && sidecar != nil {
+		if err := os.WriteFile(SidecarPath(res.OutputPath), sidecar, 0o600); err != nil {
+			res.Err = fmt.Errorf("failed to write location sidecar: %w", err)
+			if revertErr := exif.Revert(res); revertErr != nil {
+				res.Err = fmt.Errorf("%w (reverting the change also failed: %s)", res.Err, revertErr)
+			}
+		}
+	}
+	return res
+}
+
+// coarsenedLocationTags are the GPS tags a coarsened location is recorded in.
+var coarsenedLocationTags = []string{"GPSLatitude", "GPSLongitude", "GPSLatitudeRef", "GPSLongitudeRef", "GPSPosition"}
+
+// Verify checks that the file at path has no GPS tags left, in any group, nor any of DeepTags if
+// deep is set. If grid is set, the file may instead have a location rounded to a grid of that
+// many degrees (see CoarsenArgs).
+func Verify(ctx context.Context, et *exif.Exiftool, path string, grid float64, deep bool) error {
+	result, err := et.ReadJSON(ctx, append([]string{"-a", "-G1", "-n"}, LocationArgs(deep)...), path)
+	if err != nil {
+		return err
+	}
+	if len(result) != 1 {
+		return fmt.Errorf("invalid exiftool output: expected 1 item, got %d", len(result))
+	}
+	var remaining []string
+	for key, value := range result[0] {
+		// GPSVersionID isn't location data, and exiftool won't remove it from some formats:
+		if key == "SourceFile" || strings.HasSuffix(key, ":GPSVersionID") {
+			continue
+		}
+		if grid > 0 && slices.Contains(coarsenedLocationTags, exif.TagName(key)) {
+			if degrees, ok := value.(float64); ok && !onGrid(degrees, grid) {
+				return fmt.Errorf("%s %v is not rounded to a %v° grid", key, degrees, grid)
+			}
+			continue
+		}
+		remaining = append(remaining, key)
+	}
+	if len(remaining) != 0 {
+		sort.Strings(remaining)
+		return fmt.Errorf("location tags remain: %s", strings.Join(remaining, ", "))
+	}
+	return nil
+}
+
+// onGrid reports whether degrees is a multiple of grid, allowing for the precision lost when
+// exiftool stores degrees as rationals.
+func onGrid(degrees, grid float64) bool {
+	steps := math.Abs(degrees) / grid
+	return math.Abs(steps-math.Round(steps)) < 1e-4
+}
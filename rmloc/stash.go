@@ -0,0 +1,184 @@
+package rmloc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"xtool/exif"
+	"xtool/stash"
+)
+
+// SidecarSuffix is appended to an image's filename to name the sidecar file its location is
+// stashed in.
+const SidecarSuffix = ".xtoolloc.json"
+
+var ErrNoStash = errors.New("no stashed location found")
+
+// ErrPlaintextSidecarCopy is returned when an unencrypted sidecar stash would be written next to
+// a copy of the file (as with -s or -d), which is usually the copy meant to be shared.
+var ErrPlaintextSidecarCopy = errors.New("an unencrypted location sidecar can't be written alongside a copy of the file; encrypt the stash, or modify the file in place")
+
+// StashMode says where Remove stashes the location tags it removes, so Restore can put them back.
+type StashMode int
+
+const (
+	StashNone    StashMode = iota
+	StashSidecar           // a JSON sidecar file next to the modified file (see SidecarPath)
+	StashXMP               // xtool's XMP attributes, encrypted; requires a passphrase
+)
+
+// Stash holds the location tags removed from a file.
+type Stash struct {
+	Tags map[string][]string `json:"tags"` // values keyed by group-qualified tag name (eg. "GPS:GPSLatitude"), as read with exiftool -n
+}
+
+// SidecarPath returns the path of the sidecar file file's location is stashed in.
+func SidecarPath(file string) string {
+	return file + SidecarSuffix
+}
+
+// ReadStashable reads the location tags in file that Remove would remove, for stashing.
+func ReadStashable(ctx context.Context, et *exif.Exiftool, file string, deep bool) (Stash, error) {
+	result, err := et.ReadJSON(ctx, append([]string{"-a", "-G1", "-n"}, LocationArgs(deep)...), file)
+	if err != nil {
+		return Stash{}, err
+	}
+	if len(result) != 1 {
+		return Stash{}, fmt.Errorf("invalid exiftool output: expected 1 item, got %d", len(result))
+	}
+	s := Stash{Tags: make(map[string][]string)}
+	for key := range result[0] {
+		// Composite tags are derived from others, and can't be written:
+		if key == "SourceFile" || strings.HasPrefix(key, "Composite:") {
+			continue
+		}
+		s.Tags[key] = result[0].Strings(key)
+	}
+	return s, nil
+}
+
+// encode returns s JSON-encoded, and encrypted with passphrase if it's set.
+func (s Stash) encode(passphrase string) ([]byte, error) {
+	stashJSON, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode stashed location: %w", err)
+	}
+	if passphrase == "" {
+		return stashJSON, nil
+	}
+	encrypted, err := stash.Encrypt(stashJSON, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt stashed location: %w", err)
+	}
+	return []byte(encrypted), nil
+}
+
+func decodeStash(value []byte, passphrase string) (Stash, error) {
+	if stash.IsEncrypted(string(value)) {
+		var err error
+		if value, err = stash.Decrypt(string(value), passphrase); err != nil {
+			return Stash{}, fmt.Errorf("failed to decrypt stashed location: %w", err)
+		}
+	}
+	var s Stash
+	if err := json.Unmarshal(value, &s); err != nil {
+		return Stash{}, fmt.Errorf("failed to parse stashed location: %w", err)
+	}
+	return s, nil
+}
+
+// ReadStash reads the location stashed for file, from xtool's XMP attributes or from its sidecar
+// file. It fails with ErrNoStash if neither exists. It reports whether the stash came from a sidecar.
+func ReadStash(ctx context.Context, et *exif.Exiftool, file string, passphrase string) (Stash, bool, error) {
+	result, err := et.ReadJSON(ctx, []string{"-" + exif.TagLocationStash}, file)
+	if err != nil {
+		return Stash{}, false, err
+	}
+	if len(result) != 1 {
+		return Stash{}, false, fmt.Errorf("invalid exiftool output: expected 1 item, got %d", len(result))
+	}
+	if value, ok := result[0].String(exif.TagLocationStash); ok {
+		s, err := decodeStash([]byte(value), passphrase)
+		return s, false, err
+	}
+
+	value, err := os.ReadFile(SidecarPath(file))
+	if os.IsNotExist(err) {
+		return Stash{}, false, ErrNoStash
+	} else if err != nil {
+		return Stash{}, false, fmt.Errorf("failed to read location sidecar: %w", err)
+	}
+	s, err := decodeStash(value, passphrase)
+	return s, true, err
+}
+
+// RestoreArgs returns the exiftool arguments that replace a file's location tags (including any
+// coarsened location) with those in s.
+func RestoreArgs(s Stash, out exif.Output) []string {
+	// stashed values were read with -n, so they must be written with -n:
+	exiftoolArgs := []string{"-n", "-gps*=", "-" + exif.TagLocationPrecision + "=", "-" + exif.TagLocationStash + "="}
+	keys := make([]string, 0, len(s.Tags))
+	for key := range s.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// assigning a list-type tag multiple times in one command sets the list to all the assigned values:
+		for _, value := range s.Tags[key] {
+			exiftoolArgs = append(exiftoolArgs, fmt.Sprintf("-%s=%s", key, value))
+		}
+	}
+	return append(exiftoolArgs, out.Args("relocated")...)
+}
+
+// Restore restores the location stashed by Remove for file. passphrase must be the passphrase
+// the location was encrypted with, if it was. A sidecar file is removed once its location has
+// been restored to the file it belongs to.
+// It fails with ErrNoStash if no location was stashed for file.
+func Restore(ctx context.Context, et *exif.Exiftool, file string, out exif.Output, passphrase string, startTime time.Time) exif.Result {
+	s, fromSidecar, err := ReadStash(ctx, et, file, passphrase)
+	if err != nil {
+		return exif.Result{File: file, Err: err}
+	}
+	res := et.ProcessFile(ctx, RestoreArgs(s, out), file, startTime)
+	if res.Err == nil && fromSidecar && res.OutputPath == file {
+		if err := os.Remove(SidecarPath(file)); err != nil {
+			res.Warning = fmt.Errorf("failed to remove location sidecar: %w", err)
+		}
+	}
+	return res
+}
+
+// stashArgs reads the location tags in file for stashing, and returns the exiftool arguments
+// that store them in xtool's XMP attributes, if opts.Stash is StashXMP. For StashSidecar, it
+// returns the encoded stash for writeSidecar.
+func stashArgs(ctx context.Context, et *exif.Exiftool, file string, opts Options) ([]string, []byte, error) {
+	s, err := ReadStashable(ctx, et, file, opts.Deep)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(s.Tags) == 0 {
+		return nil, nil, nil
+	}
+	if opts.Stash == StashSidecar && opts.Passphrase == "" && (opts.Output.Dir != "" || opts.Output.Suffix) {
+		return nil, nil, ErrPlaintextSidecarCopy
+	}
+	if opts.Stash == StashXMP {
+		if opts.Passphrase == "" {
+			return nil, nil, stash.ErrNoPassphrase
+		}
+		encoded, err := s.encode(opts.Passphrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []string{fmt.Sprintf("-%s=%s", exif.TagLocationStash, encoded)}, nil, nil
+	}
+	encoded, err := s.encode(opts.Passphrase)
+	return nil, encoded, err
+}
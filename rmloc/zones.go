@@ -0,0 +1,101 @@
+package rmloc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+const earthRadiusMeters = 6371000
+
+// Zone is a named area, such as home or a client's site, whose locations should not be shared.
+// It is either a circle (Latitude, Longitude & RadiusMeters) or a Polygon.
+type Zone struct {
+	Name         string       `json:"name"`
+	Latitude     float64      `json:"lat,omitempty"`
+	Longitude    float64      `json:"lon,omitempty"`
+	RadiusMeters float64      `json:"radius_m,omitempty"`
+	Polygon      [][2]float64 `json:"polygon,omitempty"` // vertices as [lat, lon] pairs
+}
+
+func (z Zone) Validate() error {
+	if z.Name == "" {
+		return errors.New("zone must have a name")
+	}
+	if z.RadiusMeters != 0 && len(z.Polygon) != 0 {
+		return fmt.Errorf("zone '%s' must be either a circle (radius_m) or a polygon, not both", z.Name)
+	}
+	if len(z.Polygon) != 0 {
+		if len(z.Polygon) < 3 {
+			return fmt.Errorf("zone '%s': polygon must have at least 3 vertices", z.Name)
+		}
+		for i, vertex := range z.Polygon {
+			if err := validateCoordinates(vertex[0], vertex[1]); err != nil {
+				return fmt.Errorf("zone '%s': polygon vertex %d: %w", z.Name, i+1, err)
+			}
+		}
+		return nil
+	}
+	if z.RadiusMeters <= 0 {
+		return fmt.Errorf("zone '%s' must set a positive radius_m, or a polygon", z.Name)
+	}
+	if err := validateCoordinates(z.Latitude, z.Longitude); err != nil {
+		return fmt.Errorf("zone '%s': %w", z.Name, err)
+	}
+	return nil
+}
+
+func validateCoordinates(lat, lon float64) error {
+	if lat < -90 || lat > 90 {
+		return fmt.Errorf("latitude %v is out of range", lat)
+	}
+	if lon < -180 || lon > 180 {
+		return fmt.Errorf("longitude %v is out of range", lon)
+	}
+	return nil
+}
+
+// Contains reports whether loc is inside the zone.
+func (z Zone) Contains(loc Location) bool {
+	if len(z.Polygon) != 0 {
+		return polygonContains(z.Polygon, loc)
+	}
+	return DistanceMeters(Location{Latitude: z.Latitude, Longitude: z.Longitude}, loc) <= z.RadiusMeters
+}
+
+// ZoneContaining returns the first of zones containing loc.
+func ZoneContaining(zones []Zone, loc Location) (Zone, bool) {
+	for _, z := range zones {
+		if z.Contains(loc) {
+			return z, true
+		}
+	}
+	return Zone{}, false
+}
+
+// DistanceMeters returns the great-circle distance between a and b.
+func DistanceMeters(a, b Location) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat, dLon := lat2-lat1, radians(b.Longitude-a.Longitude)
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(h))
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// polygonContains reports whether loc is inside polygon, treating latitude and longitude as
+// planar coordinates; that's accurate enough for zones the size of a neighborhood.
+func polygonContains(polygon [][2]float64, loc Location) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		latI, lonI := polygon[i][0], polygon[i][1]
+		latJ, lonJ := polygon[j][0], polygon[j][1]
+		if (latI > loc.Latitude) != (latJ > loc.Latitude) &&
+			loc.Longitude < (lonJ-lonI)*(loc.Latitude-latI)/(latJ-latI)+lonI {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,92 @@
+package rmloc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPolygonContains(t *testing.T) {
+	square := [][2]float64{{42.0, -84.0}, {42.0, -83.0}, {43.0, -83.0}, {43.0, -84.0}}
+	// a U shape, open to the north:
+	concave := [][2]float64{{0, 0}, {0, 3}, {3, 3}, {3, 2}, {1, 2}, {1, 1}, {3, 1}, {3, 0}}
+
+	for _, tc := range []struct {
+		name    string
+		polygon [][2]float64
+		loc     Location
+		want    bool
+	}{
+		{"inside square", square, Location{42.5, -83.5}, true},
+		{"north of square", square, Location{43.5, -83.5}, false},
+		{"east of square", square, Location{42.5, -82.5}, false},
+		{"west of square", square, Location{42.5, -84.5}, false},
+		{"south of square", square, Location{41.5, -83.5}, false},
+		{"inside left arm", concave, Location{2, 0.5}, true},
+		{"inside right arm", concave, Location{2, 2.5}, true},
+		{"inside base", concave, Location{0.5, 1.5}, true},
+		{"in the notch", concave, Location{2, 1.5}, false},
+		{"triangle", [][2]float64{{0, 0}, {0, 2}, {2, 1}}, Location{0.5, 1}, true},
+		{"outside triangle", [][2]float64{{0, 0}, {0, 2}, {2, 1}}, Location{1.5, 0.2}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := polygonContains(tc.polygon, tc.loc); got != tc.want {
+				t.Errorf("polygonContains(%v) = %v; want %v", tc.loc, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDistanceMeters(t *testing.T) {
+	oneDegree := earthRadiusMeters * math.Pi / 180
+
+	for _, tc := range []struct {
+		name string
+		a, b Location
+		want float64
+	}{
+		{"same point", Location{42.28, -83.74}, Location{42.28, -83.74}, 0},
+		{"one degree of latitude", Location{10, 20}, Location{11, 20}, oneDegree},
+		{"one degree of longitude at the equator", Location{0, 20}, Location{0, 21}, oneDegree},
+		{"one degree of longitude at 60°N", Location{60, 20}, Location{60, 21}, 55596.5},
+		{"across the antimeridian", Location{0, 179}, Location{0, -179}, 2 * oneDegree},
+		{"pole to pole", Location{90, 0}, Location{-90, 0}, 180 * oneDegree},
+		{"Ann Arbor to Detroit", Location{42.2808, -83.7430}, Location{42.3314, -83.0458}, 57609.7},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DistanceMeters(tc.a, tc.b); math.Abs(got-tc.want) > 1 {
+				t.Errorf("DistanceMeters(%v, %v) = %.1f; want %.1f", tc.a, tc.b, got, tc.want)
+			}
+			if got := DistanceMeters(tc.b, tc.a); math.Abs(got-tc.want) > 1 {
+				t.Errorf("DistanceMeters(%v, %v) = %.1f; want %.1f", tc.b, tc.a, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestZoneValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		zone    Zone
+		wantErr bool
+	}{
+		{"circle", Zone{Name: "home", Latitude: 42.28, Longitude: -83.74, RadiusMeters: 200}, false},
+		{"polygon", Zone{Name: "work", Polygon: [][2]float64{{42, -84}, {42, -83}, {43, -83}}}, false},
+		{"extreme coordinates", Zone{Name: "edge", Latitude: -90, Longitude: 180, RadiusMeters: 1}, false},
+		{"no name", Zone{Latitude: 42.28, Longitude: -83.74, RadiusMeters: 200}, true},
+		{"no radius", Zone{Name: "home", Latitude: 42.28, Longitude: -83.74}, true},
+		{"circle and polygon", Zone{Name: "both", RadiusMeters: 200, Polygon: [][2]float64{{42, -84}, {42, -83}, {43, -83}}}, true},
+		{"too few vertices", Zone{Name: "line", Polygon: [][2]float64{{42, -84}, {42, -83}}}, true},
+		{"latitude out of range", Zone{Name: "home", Latitude: 91, Longitude: -83.74, RadiusMeters: 200}, true},
+		{"longitude out of range", Zone{Name: "home", Latitude: 42.28, Longitude: -183.74, RadiusMeters: 200}, true},
+		{"swapped lat/lon", Zone{Name: "home", Latitude: -122.42, Longitude: 37.77, RadiusMeters: 200}, true},
+		{"vertex latitude out of range", Zone{Name: "work", Polygon: [][2]float64{{42, -84}, {-92, -83}, {43, -83}}}, true},
+		{"vertex longitude out of range", Zone{Name: "work", Polygon: [][2]float64{{42, -84}, {42, -83}, {43, 183}}}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.zone.Validate()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Validate() = %v; want error: %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Package stash encrypts the original metadata values xtool stashes in files, so that they can
+// only be restored by someone who knows the passphrase they were stashed with.
+package stash
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnvVar names the environment variable a stash passphrase is read from, if no
+// passphrase file is given.
+const PassphraseEnvVar = "XTOOL_STASH_PASSPHRASE"
+
+// encryptedPrefix identifies (and versions) the encoding Encrypt produces.
+const encryptedPrefix = "xtool-enc-v1:"
+
+const (
+	saltLen = 16
+	keyLen  = 32
+	// scrypt parameters recommended for interactive use as of 2017:
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var (
+	ErrNoPassphrase    = fmt.Errorf("a passphrase is required; set %s or give a passphrase file", PassphraseEnvVar)
+	ErrWrongPassphrase = errors.New("wrong passphrase, or the encrypted data is corrupt")
+)
+
+// Passphrase returns the passphrase read from passphraseFile (ignoring a trailing newline), or
+// from the PassphraseEnvVar environment variable if passphraseFile is empty. It returns an empty
+// string if passphraseFile is empty and the environment variable isn't set.
+func Passphrase(passphraseFile string) (string, error) {
+	if passphraseFile == "" {
+		return os.Getenv(PassphraseEnvVar), nil
+	}
+	b, err := os.ReadFile(passphraseFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+	passphrase := strings.TrimRight(string(b), "\r\n")
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase file '%s' is empty", passphraseFile)
+	}
+	return passphrase, nil
+}
+
+// IsEncrypted reports whether s was produced by Encrypt.
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, encryptedPrefix)
+}
+
+// Encrypt encrypts plaintext with a key derived from passphrase, returning a string suitable for
+// storing in a metadata tag.
+func Encrypt(plaintext []byte, passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", ErrNoPassphrase
+	}
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := append(append(salt, nonce...), aead.Seal(nil, nonce, plaintext, nil)...)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts s, which must have been produced by Encrypt with the same passphrase.
+func Decrypt(s string, passphrase string) ([]byte, error) {
+	if !IsEncrypted(s) {
+		return nil, errors.New("not encrypted by xtool")
+	}
+	if passphrase == "" {
+		return nil, ErrNoPassphrase
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, encryptedPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encrypted data: %w", err)
+	}
+	if len(sealed) < saltLen {
+		return nil, ErrWrongPassphrase
+	}
+	aead, err := newAEAD(passphrase, sealed[:saltLen])
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[saltLen:]
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keyLen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key from passphrase: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,93 @@
+package stash
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	plaintext := []byte(`{"IFD0:Artist":["Jane Doe"]}`)
+	encrypted, err := Encrypt(plaintext, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encrypted, encryptedPrefix) {
+		t.Errorf("Encrypt() = %q; want the %q prefix", encrypted, encryptedPrefix)
+	}
+	if strings.Contains(encrypted, "Jane Doe") {
+		t.Errorf("Encrypt() = %q; contains the plaintext", encrypted)
+	}
+	if again, _ := Encrypt(plaintext, "hunter2"); again == encrypted {
+		t.Error("Encrypt() twice gave the same result; want a fresh salt and nonce each time")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, encryptedPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := make([]byte, len(sealed))
+	copy(tampered, sealed)
+	tampered[len(tampered)-1] ^= 1
+
+	for _, tc := range []struct {
+		name       string
+		value      string
+		passphrase string
+		wantErr    error // nil to expect plaintext back
+	}{
+		{"round trip", encrypted, "hunter2", nil},
+		{"wrong passphrase", encrypted, "hunter3", ErrWrongPassphrase},
+		{"no passphrase", encrypted, "", ErrNoPassphrase},
+		{"tampered ciphertext", encryptedPrefix + base64.StdEncoding.EncodeToString(tampered), "hunter2", ErrWrongPassphrase},
+		{"truncated", encryptedPrefix + base64.StdEncoding.EncodeToString(sealed[:saltLen+4]), "hunter2", ErrWrongPassphrase},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Decrypt(tc.value, tc.passphrase)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Decrypt() error = %v; want %v", err, tc.wantErr)
+			}
+			if tc.wantErr == nil && string(got) != string(plaintext) {
+				t.Errorf("Decrypt() = %q; want %q", got, plaintext)
+			}
+		})
+	}
+
+	if _, err := Encrypt(plaintext, ""); !errors.Is(err, ErrNoPassphrase) {
+		t.Errorf("Encrypt() with no passphrase: error = %v; want %v", err, ErrNoPassphrase)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	for _, tc := range []struct {
+		value         string
+		wantEncrypted bool
+	}{
+		{"xtool-enc-v1:c2FsdA==", true},
+		{"xtool-enc-v1:", true},
+		{`{"IFD0:Artist":["Jane Doe"]}`, false},
+		{"xtool-enc-v2:c2FsdA==", false},
+		{" xtool-enc-v1:c2FsdA==", false},
+		{"", false},
+	} {
+		if got := IsEncrypted(tc.value); got != tc.wantEncrypted {
+			t.Errorf("IsEncrypted(%q) = %v; want %v", tc.value, got, tc.wantEncrypted)
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		value string
+	}{
+		{"plaintext", `{"IFD0:Artist":["Jane Doe"]}`},
+		{"invalid base64", "xtool-enc-v1:not base64!"},
+		{"empty", "xtool-enc-v1:"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Decrypt(tc.value, "hunter2"); err == nil {
+				t.Errorf("Decrypt(%q): want an error", tc.value)
+			}
+		})
+	}
+}
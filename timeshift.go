@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/google/subcommands"
+
+	"xtool/exif"
+	"xtool/timeshift"
+)
+
+type timeshiftCmd struct {
+	offset    time.Duration
+	refFile   string
+	refTime   string
+	timeZone  string
+	restore   bool
+	dryRun    bool
+	suffix    bool
+	outDir    string
+	verbose   bool
+	verbose2  bool
+	appConfig AppConfig
+}
+
+func (*timeshiftCmd) Name() string { return "timeshift" }
+func (*timeshiftCmd) Synopsis() string {
+	return "Correct capture times from a camera with a wrong clock."
+}
+
+func (*timeshiftCmd) Usage() string {
+	return `timeshift [-offset DURATION | -ref ref.jpg -ref-time "YYYY:MM:DD HH:MM:SS"] [-tz ZONE] [-n] [-s] [-d out_dir] [-v|-vv] file1.jpg [file2.nef ...]
+timeshift -r [-s] [-d out_dir] [-v|-vv] file1.jpg [file2.nef ...]:
+  Shifts the given photos' capture times (DateTimeOriginal, CreateDate, ModifyDate, and their XMP
+  and QuickTime equivalents) by -offset (eg. 1h30m, or -45s), or by the offset that corrects the
+  reference photo's DateTimeOriginal to -ref-time.
+  With -tz, sets the OffsetTime* tags to the given time zone, as an IANA name (eg. America/Detroit)
+  or a UTC offset (eg. -04:00).
+  Persists the original times in an XMP attribute for restoration with the -r flag. A photo may be
+  shifted repeatedly; -r restores the times it had before its first shift.
+  With -n, prints each photo's current and shifted DateTimeOriginal without modifying any files.
+`
+}
+
+func (p *timeshiftCmd) SetFlags(f *flag.FlagSet) {
+	f.DurationVar(&p.offset, "offset", 0, "Shift times by this duration (negative to shift them earlier).")
+	f.StringVar(&p.refFile, "ref", "", "Reference photo whose correct capture time is given by -ref-time.")
+	f.StringVar(&p.refTime, "ref-time", "", "The reference photo's correct capture time, as YYYY:MM:DD HH:MM:SS.")
+	f.StringVar(&p.timeZone, "tz", "", "Set OffsetTime* to this time zone, as an IANA name or UTC offset.")
+	f.BoolVar(&p.restore, "r", false, "Restore the original times, using xtool's XMP attributes.")
+	f.BoolVar(&p.dryRun, "n", false, "Dry run: print each image's current and shifted times, without modifying it.")
+	f.BoolVar(&p.suffix, "s", false, "Write modified images to new files named with the suffix _shifted (or _unshifted with -r), rather than to the originals.")
+	f.StringVar(&p.outDir, "d", "", "Write modified images to this directory.")
+	f.BoolVar(&p.verbose, "v", false, "Print full exiftool output for each image.")
+	f.BoolVar(&p.verbose2, "vv", false, "Print exiftool commands and full exiftool output.")
+}
+
+func (p *timeshiftCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if p.verbose2 {
+		p.verbose = true
+	}
+
+	shiftGiven := p.offset != 0 || p.refFile != "" || p.timeZone != ""
+	if len(f.Args()) == 0 || (p.refFile == "") != (p.refTime == "") || (p.offset != 0 && p.refFile != "") ||
+		shiftGiven == p.restore || (p.restore && p.dryRun) {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	opts := timeshift.Options{Output: exif.Output{Dir: p.outDir, Suffix: p.suffix}, Offset: p.offset}
+	if p.timeZone != "" {
+		loc, err := exif.ParseTimeZone(p.timeZone)
+		if err != nil {
+			ErrPrint(ctx, err)
+			return subcommands.ExitUsageError
+		}
+		opts.TimeZone = loc
+	}
+
+	p.appConfig = AppConfigFromCtx(ctx)
+
+	et, err := newExiftool(p.appConfig, p.verbose2)
+	if err != nil {
+		ErrPrint(ctx, err)
+		return subcommands.ExitFailure
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer func() { _ = et.Close() }()
+
+	if p.refFile != "" {
+		if opts.Offset, err = timeshift.ReferenceOffset(ctx, et, p.refFile, p.refTime); err != nil {
+			ErrPrint(ctx, err)
+			return subcommands.ExitFailure
+		}
+		fmt.Printf("shifting times by %s, per %s\n\n", color.MagentaString(opts.Offset.String()), p.refFile)
+	}
+
+	boldWhitePrintf := color.New(color.Bold, color.FgWhite).PrintfFunc()
+	boldRedPrintf := color.New(color.Bold, color.FgRed).PrintfFunc()
+
+	if p.dryRun {
+		for _, imgFilename := range f.Args() {
+			boldWhitePrintf("%s ...\n", imgFilename)
+			state, err := timeshift.ReadState(ctx, et, imgFilename)
+			if err != nil {
+				fmt.Printf("\t%s\n", err)
+				continue
+			}
+			shifted, offset, err := timeshift.Shifted(state, opts)
+			if err != nil {
+				fmt.Printf("\t%s\n", err)
+				continue
+			}
+			current, _ := state.Value("DateTimeOriginal")
+			currentOffset, _ := state.Value("OffsetTimeOriginal")
+			fmt.Printf("\t%s %s%s → %s%s\n", color.MagentaString("DateTimeOriginal:"), current, currentOffset, exif.FormatDateTime(shifted), offset)
+			if state.Shifted() {
+				fmt.Printf("\t(already shifted; -r will still restore the times it had before its first shift)\n")
+			}
+		}
+		boldWhitePrintf("\ntimeshift: dry run; no images were modified.\n")
+		return subcommands.ExitSuccess
+	}
+
+	process := func(imgFilename string, startTime time.Time) exif.Result {
+		state, err := timeshift.ReadState(ctx, et, imgFilename)
+		if err != nil {
+			return exif.Result{File: imgFilename, Err: err}
+		}
+		if shifted, offset, err := timeshift.Shifted(state, opts); err == nil && p.verbose {
+			fmt.Printf("DateTimeOriginal → %s%s\n", exif.FormatDateTime(shifted), offset)
+		}
+		return timeshift.ShiftFrom(ctx, et, imgFilename, state, opts, startTime)
+	}
+	if p.restore {
+		process = func(imgFilename string, startTime time.Time) exif.Result {
+			return timeshift.Restore(ctx, et, imgFilename, opts.Output, startTime)
+		}
+	}
+
+	successes, failures := ExiftoolProcess(ctx, f.Args(), p.verbose, p.verbose2, process)
+
+	boldWhitePrintf("\ntimeshift: successfully processed %d images.\n", len(successes))
+
+	if len(failures) != 0 {
+		boldRedPrintf("Errors:\n")
+		for filename, err := range failures {
+			fmt.Printf("- %s %s\n", color.MagentaString("%s:", filename), err)
+		}
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
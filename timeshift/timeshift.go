@@ -0,0 +1,265 @@
+// Package timeshift corrects the capture times recorded in images made with a camera whose
+// clock was wrong. The original times are stashed in an xtool XMP tag, so they can be restored later.
+package timeshift
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"xtool/exif"
+)
+
+var ErrNotShifted = errors.New("no timeshift metadata attached")
+
+// Tags lists the date/time tags timeshift shifts. Writing a tag by name updates every group
+// (EXIF, XMP, QuickTime) the tag exists in.
+var Tags = []string{
+	"DateTimeOriginal", "CreateDate", "ModifyDate",
+	"XMP-photoshop:DateCreated",
+	"TrackCreateDate", "TrackModifyDate", "MediaCreateDate", "MediaModifyDate",
+}
+
+// OffsetTags lists the tags recording the time zone of Tags.
+var OffsetTags = []string{"OffsetTime", "OffsetTimeOriginal", "OffsetTimeDigitized"}
+
+// State is a file's date/time metadata.
+type State struct {
+	Current map[string]string // current values of Tags and OffsetTags, keyed by group-qualified tag name
+	Stash   string            // the stashed original values; empty if the file hasn't been shifted
+}
+
+func (s State) Shifted() bool {
+	return s.Stash != ""
+}
+
+// Originals decodes the stashed original values, keyed by group-qualified tag name.
+func (s State) Originals() (map[string]string, error) {
+	if !s.Shifted() {
+		return nil, ErrNotShifted
+	}
+	var originals map[string]string
+	if err := json.Unmarshal([]byte(s.Stash), &originals); err != nil {
+		return nil, fmt.Errorf("failed to parse stashed times: %w", err)
+	}
+	return originals, nil
+}
+
+// Value returns the current value of the given tag, preferring its EXIF value.
+func (s State) Value(tag string) (string, bool) {
+	best := ""
+	for key := range s.Current {
+		if exif.TagName(key) != tag {
+			continue
+		}
+		if strings.HasPrefix(key, "ExifIFD:") {
+			return s.Current[key], true
+		}
+		if best == "" || key < best {
+			best = key
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return s.Current[best], true
+}
+
+// StateArgs returns the exiftool arguments that read the tags StateFromMetadata needs.
+func StateArgs() []string {
+	args := []string{"-a", "-G1", "-" + exif.TagOriginalTimes}
+	for _, tag := range append(slices.Clone(Tags), OffsetTags...) {
+		args = append(args, "-"+tag)
+	}
+	return args
+}
+
+// StateFromMetadata returns the timeshift state recorded in a file's metadata, which must have
+// been read with StateArgs.
+func StateFromMetadata(m exif.Metadata) State {
+	state := State{Current: make(map[string]string)}
+	for key := range m {
+		if key == "SourceFile" {
+			continue
+		}
+		if exif.TagName(key) == exif.TagOriginalTimes {
+			state.Stash, _ = m.String(key)
+		} else if value, ok := m.String(key); ok {
+			state.Current[key] = value
+		}
+	}
+	return state
+}
+
+// ReadState reads file's timeshift state.
+func ReadState(ctx context.Context, et *exif.Exiftool, file string) (State, error) {
+	result, err := et.ReadJSON(ctx, StateArgs(), file)
+	if err != nil {
+		return State{}, err
+	}
+	if len(result) != 1 {
+		return State{}, fmt.Errorf("invalid exiftool output: expected 1 item, got %d", len(result))
+	}
+	return StateFromMetadata(result[0]), nil
+}
+
+// Options control how Shift changes a file's times.
+type Options struct {
+	Output   exif.Output
+	Offset   time.Duration  // added to each time
+	TimeZone *time.Location // if set, the OffsetTime* tags are set to this time zone's offset at the shifted DateTimeOriginal
+}
+
+// Shifted returns the shifted DateTimeOriginal of a file with the given state, and the UTC offset
+// OffsetTime* would be set to (or the current OffsetTimeOriginal, if opts.TimeZone isn't set).
+func Shifted(state State, opts Options) (time.Time, string, error) {
+	dateTime, ok := state.Value("DateTimeOriginal")
+	if !ok {
+		return time.Time{}, "", errors.New("no DateTimeOriginal")
+	}
+	t, err := exif.ParseDateTime(dateTime, time.UTC)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	t = t.Add(opts.Offset)
+
+	offset, _ := state.Value("OffsetTimeOriginal")
+	if opts.TimeZone != nil {
+		// t's fields are the local time in opts.TimeZone:
+		local := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, opts.TimeZone)
+		offset = exif.FormatOffset(local)
+	}
+	return t, offset, nil
+}
+
+// ShiftArgs returns the exiftool arguments that shift each of Tags in a file with the given state
+// by opts.Offset, and set its OffsetTime* tags if opts.TimeZone is set. The original values are
+// stashed, unless the file has already been shifted, in which case the earlier stash is kept.
+func ShiftArgs(state State, opts Options) ([]string, error) {
+	var exiftoolArgs []string
+	if !state.Shifted() {
+		originalsJSON, err := json.Marshal(state.Current)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode original times: %w", err)
+		}
+		exiftoolArgs = append(exiftoolArgs, fmt.Sprintf("-%s=%s", exif.TagOriginalTimes, originalsJSON))
+	}
+
+	if shift, op := formatShift(opts.Offset); shift != "" {
+		for _, tag := range Tags {
+			exiftoolArgs = append(exiftoolArgs, fmt.Sprintf("-%s%s%s", tag, op, shift))
+		}
+	}
+	if opts.TimeZone != nil {
+		_, offset, err := Shifted(state, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range OffsetTags {
+			exiftoolArgs = append(exiftoolArgs, fmt.Sprintf("-%s=%s", tag, offset))
+		}
+	}
+	return append(exiftoolArgs, opts.Output.Args("shifted")...), nil
+}
+
+// formatShift formats d as an exiftool date/time shift ("h:m:s") and the assignment operator
+// applying it. It returns an empty shift if d rounds to zero seconds.
+func formatShift(d time.Duration) (string, string) {
+	op := "+="
+	if d < 0 {
+		op = "-="
+		d = -d
+	}
+	seconds := int64(d.Round(time.Second) / time.Second)
+	if seconds == 0 {
+		return "", op
+	}
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60), op
+}
+
+// RestoreArgs returns the exiftool arguments that restore the original times stashed in a file
+// with the given state, and remove the stash.
+func RestoreArgs(state State, out exif.Output) ([]string, error) {
+	originals, err := state.Originals()
+	if err != nil {
+		return nil, err
+	}
+
+	var exiftoolArgs []string
+	for key := range state.Current {
+		// remove time zones that were added by timeshift:
+		if _, ok := originals[key]; !ok && slices.Contains(OffsetTags, exif.TagName(key)) {
+			exiftoolArgs = append(exiftoolArgs, "-"+key+"=")
+		}
+	}
+	keys := make([]string, 0, len(originals))
+	for key := range originals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		exiftoolArgs = append(exiftoolArgs, fmt.Sprintf("-%s=%s", key, originals[key]))
+	}
+	exiftoolArgs = append(exiftoolArgs, "-"+exif.TagOriginalTimes+"=")
+	return append(exiftoolArgs, out.Args("unshifted")...), nil
+}
+
+// Shift shifts file's times as described by opts (see ShiftArgs). See exif.Exiftool.ProcessFile
+// for how backups are handled.
+func Shift(ctx context.Context, et *exif.Exiftool, file string, opts Options, startTime time.Time) exif.Result {
+	state, err := ReadState(ctx, et, file)
+	if err != nil {
+		return exif.Result{File: file, Err: err}
+	}
+	return ShiftFrom(ctx, et, file, state, opts, startTime)
+}
+
+// ShiftFrom is Shift for a file whose timeshift state has already been read.
+func ShiftFrom(ctx context.Context, et *exif.Exiftool, file string, state State, opts Options, startTime time.Time) exif.Result {
+	exiftoolArgs, err := ShiftArgs(state, opts)
+	if err != nil {
+		return exif.Result{File: file, Err: err}
+	}
+	return et.ProcessFile(ctx, exiftoolArgs, file, startTime)
+}
+
+// Restore restores the original times stashed in file by Shift.
+// It fails with ErrNotShifted if the file has not been shifted.
+func Restore(ctx context.Context, et *exif.Exiftool, file string, out exif.Output, startTime time.Time) exif.Result {
+	state, err := ReadState(ctx, et, file)
+	if err != nil {
+		return exif.Result{File: file, Err: err}
+	}
+	exiftoolArgs, err := RestoreArgs(state, out)
+	if err != nil {
+		return exif.Result{File: file, Err: err}
+	}
+	return et.ProcessFile(ctx, exiftoolArgs, file, startTime)
+}
+
+// ReferenceOffset returns the offset that corrects the camera clock of the reference file, whose
+// DateTimeOriginal should be correctTime (formatted as an EXIF date/time).
+func ReferenceOffset(ctx context.Context, et *exif.Exiftool, file string, correctTime string) (time.Duration, error) {
+	state, err := ReadState(ctx, et, file)
+	if err != nil {
+		return 0, err
+	}
+	dateTime, ok := state.Value("DateTimeOriginal")
+	if !ok {
+		return 0, fmt.Errorf("reference photo '%s' has no DateTimeOriginal", file)
+	}
+	cameraTime, err := exif.ParseDateTime(dateTime, time.UTC)
+	if err != nil {
+		return 0, err
+	}
+	trueTime, err := exif.ParseDateTime(correctTime, time.UTC)
+	if err != nil {
+		return 0, err
+	}
+	return trueTime.Sub(cameraTime), nil
+}
@@ -0,0 +1,167 @@
+package timeshift
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+	_ "time/tzdata" // for America/Detroit, on systems without a time zone database
+
+	"xtool/exif"
+)
+
+func TestFormatShift(t *testing.T) {
+	for _, tc := range []struct {
+		d         time.Duration
+		wantShift string
+		wantOp    string
+	}{
+		{0, "", "+="},
+		{400 * time.Millisecond, "", "+="},
+		{time.Second, "0:00:01", "+="},
+		{90 * time.Minute, "1:30:00", "+="},
+		{-90 * time.Minute, "1:30:00", "-="},
+		{26*time.Hour + 3*time.Minute + 4*time.Second, "26:03:04", "+="},
+		{-(time.Hour + 1500*time.Millisecond), "1:00:02", "-="},
+	} {
+		shift, op := formatShift(tc.d)
+		if shift != tc.wantShift || op != tc.wantOp {
+			t.Errorf("formatShift(%s) = %q, %q; want %q, %q", tc.d, shift, op, tc.wantShift, tc.wantOp)
+		}
+	}
+}
+
+func TestShifted(t *testing.T) {
+	detroit, err := time.LoadLocation("America/Detroit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := State{Current: map[string]string{
+		"ExifIFD:DateTimeOriginal":   "2024:03:10 01:30:00",
+		"XMP-exif:DateTimeOriginal":  "2024:03:10 09:30:00",
+		"ExifIFD:OffsetTimeOriginal": "+01:00",
+	}}
+
+	for _, tc := range []struct {
+		name       string
+		state      State
+		opts       Options
+		wantTime   string
+		wantOffset string
+		wantErr    bool
+	}{
+		{
+			name:       "offset only, prefers EXIF",
+			state:      state,
+			opts:       Options{Offset: -2 * time.Hour},
+			wantTime:   "2024:03:09 23:30:00",
+			wantOffset: "+01:00",
+		},
+		{
+			name:       "fixed time zone",
+			state:      state,
+			opts:       Options{TimeZone: time.FixedZone("", -5*3600)},
+			wantTime:   "2024:03:10 01:30:00",
+			wantOffset: "-05:00",
+		},
+		{
+			name:       "time zone offset at the shifted time",
+			state:      state,
+			opts:       Options{Offset: 2 * time.Hour, TimeZone: detroit},
+			wantTime:   "2024:03:10 03:30:00",
+			wantOffset: "-04:00",
+		},
+		{
+			name:    "no DateTimeOriginal",
+			state:   State{Current: map[string]string{"ExifIFD:CreateDate": "2024:03:10 01:30:00"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid DateTimeOriginal",
+			state:   State{Current: map[string]string{"ExifIFD:DateTimeOriginal": "0000:00:00 00:00:00"}},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, offset, err := Shifted(tc.state, tc.opts)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("Shifted() = %s, %q; want an error", got, offset)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exif.FormatDateTime(got) != tc.wantTime || offset != tc.wantOffset {
+				t.Errorf("Shifted() = %s, %q; want %s, %q", exif.FormatDateTime(got), offset, tc.wantTime, tc.wantOffset)
+			}
+		})
+	}
+}
+
+func TestRestoreArgs(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		state   State
+		out     exif.Output
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "restores originals and removes added time zones",
+			state: State{
+				Current: map[string]string{
+					"ExifIFD:DateTimeOriginal":   "2024:03:10 03:30:00",
+					"ExifIFD:CreateDate":         "2024:03:10 03:30:00",
+					"ExifIFD:OffsetTimeOriginal": "-04:00",
+				},
+				Stash: `{"ExifIFD:DateTimeOriginal":"2024:03:10 01:30:00","ExifIFD:CreateDate":"2024:03:10 01:30:00"}`,
+			},
+			want: []string{
+				"-ExifIFD:OffsetTimeOriginal=",
+				"-ExifIFD:CreateDate=2024:03:10 01:30:00",
+				"-ExifIFD:DateTimeOriginal=2024:03:10 01:30:00",
+				"-" + exif.TagOriginalTimes + "=",
+			},
+		},
+		{
+			name: "restores original time zones",
+			state: State{
+				Current: map[string]string{
+					"ExifIFD:DateTimeOriginal":   "2024:03:10 03:30:00",
+					"ExifIFD:OffsetTimeOriginal": "-04:00",
+				},
+				Stash: `{"ExifIFD:DateTimeOriginal":"2024:03:10 01:30:00","ExifIFD:OffsetTimeOriginal":"+01:00"}`,
+			},
+			out: exif.Output{Suffix: true},
+			want: []string{
+				"-ExifIFD:DateTimeOriginal=2024:03:10 01:30:00",
+				"-ExifIFD:OffsetTimeOriginal=+01:00",
+				"-" + exif.TagOriginalTimes + "=",
+				"-o", "%d%f_unshifted.%e",
+			},
+		},
+		{
+			name:    "not shifted",
+			state:   State{Current: map[string]string{"ExifIFD:DateTimeOriginal": "2024:03:10 01:30:00"}},
+			wantErr: ErrNotShifted,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := RestoreArgs(tc.state, tc.out)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("RestoreArgs() error = %v; want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("RestoreArgs() = %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
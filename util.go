@@ -7,46 +7,13 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"time"
 )
 
-func (c BackupsConfig) PrepareBackupsDir(filename string, startTime time.Time) (string, error) {
-	backupsPath := ""
-	ts := startTime.Format("2006-01-02T15-04-05")
-	absFilePath, err := filepath.Abs(filename)
-	if err != nil {
-		return "", err
-	}
-	var parentMode os.FileMode
-	switch c.BackupsLocation {
-	case BackupsLocSubDir:
-		backupsPath = filepath.Join(
-			filepath.Dir(absFilePath),
-			fmt.Sprintf("%s_%s", c.BackupsFolder, ts),
-		)
-		stat, err := os.Stat(filepath.Dir(absFilePath))
-		if err != nil {
-			return "", err
-		}
-		parentMode = stat.Mode() & os.ModePerm
-	case BackupsLocAbsPath:
-		backupsPath = filepath.Join(
-			c.BackupsFolder,
-			fmt.Sprintf("%s %s", ts, filepath.Base(filepath.Dir(absFilePath))),
-		)
-		stat, err := os.Stat(c.BackupsFolder)
-		if err != nil {
-			return "", err
-		}
-		parentMode = stat.Mode() & os.ModePerm
-	}
-	if backupsPath != "" {
-		err := os.MkdirAll(backupsPath, parentMode)
-		if err != nil {
-			return "", fmt.Errorf("failed to create backups directory '%s': %w", backupsPath, err)
-		}
-	}
-	return backupsPath, nil
+// imageExtensions are the image file extensions watch presets apply to by default, and audit scans.
+var imageExtensions = []string{
+	".jpg", ".jpeg", ".tif", ".tiff", ".png", ".heic", ".heif",
+	".dng", ".nef", ".nrw", ".cr2", ".cr3", ".crw", ".arw", ".srf", ".sr2", ".raf", ".orf", ".rw2",
+	".pef", ".srw", ".x3f", ".3fr", ".iiq", ".erf", ".mrw",
 }
 
 func MustUserHomeDir() string {
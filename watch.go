@@ -0,0 +1,669 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/subcommands"
+
+	"xtool/backup"
+)
+
+const (
+	watchStateFileName = ".xtoolwatch.json"
+	watchLogFileName   = ".xtoolwatch.log"
+	defaultWatchSettle = 5 * time.Second
+)
+
+// watchableCommands are the xtool subcommands a watch preset may run.
+// Each of them accepts image files as its trailing arguments.
+var watchableCommands = map[string]bool{
+	"camswap":   true,
+	"rmloc":     true,
+	"anonymize": true,
+	"geotag":    true,
+	"timeshift": true,
+	"neatimg":   true,
+	"preview":   true,
+	"x3fjpg":    true,
+}
+
+// newFileCommands are the watchable commands that always write new files, rather than modifying
+// the image in place.
+var newFileCommands = map[string]bool{
+	"neatimg": true,
+	"preview": true,
+	"x3fjpg":  true,
+}
+
+type watchCmd struct {
+	preset    string
+	statePath string
+	logPath   string
+	settle    time.Duration
+	appConfig AppConfig
+}
+
+func (*watchCmd) Name() string     { return "watch" }
+func (*watchCmd) Synopsis() string { return "Watch a folder and process new images as they arrive." }
+
+func (*watchCmd) Usage() string {
+	return `watch -preset NAME [-state state_file] [-log log_file] [-settle duration] DIR:
+  Watches DIR and its subfolders for new image files. Once a file's writes have settled, runs the
+  preset's command or pipeline (defined in watch_presets) on it.
+  Each step of a pipeline is run on the new file itself, so every step but the last must modify
+  it in place: only the last step may write new files (with -s or -d, or via neatimg, preview,
+  or x3fjpg).
+  Processed files are recorded in a state file, so restarting the watcher doesn't reprocess them.
+  Backups folders and files written by the preset's commands are ignored. Runs until interrupted.
+`
+}
+
+func (p *watchCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&p.preset, "preset", "", "Watch preset to apply to new files (defined in watch_presets).")
+	f.StringVar(&p.statePath, "state", "", fmt.Sprintf("State file recording processed files. Defaults to DIR/%s.", watchStateFileName))
+	f.StringVar(&p.logPath, "log", "", fmt.Sprintf("Log file. Defaults to DIR/%s.", watchLogFileName))
+	f.DurationVar(&p.settle, "settle", 0, "How long a file must be unchanged before it is processed. Overrides the preset's settle_seconds; defaults to 5s.")
+}
+
+func (p *watchCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if len(f.Args()) != 1 || p.preset == "" {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	p.appConfig = AppConfigFromCtx(ctx)
+
+	preset, ok := p.appConfig.WatchPresets[p.preset]
+	if !ok {
+		ErrPrintf(ctx, "watch preset '%s' is not defined in watch_presets\n", p.preset)
+		return subcommands.ExitUsageError
+	}
+	steps := preset.Steps()
+	if len(steps) == 0 {
+		ErrPrintf(ctx, "watch preset '%s' has no command or pipeline\n", p.preset)
+		return subcommands.ExitFailure
+	}
+	for i, step := range steps {
+		if !watchableCommands[step.Command] {
+			ErrPrintf(ctx, "watch preset '%s': '%s' is not a command watch can run\n", p.preset, step.Command)
+			return subcommands.ExitFailure
+		}
+		if i < len(steps)-1 && stepWritesNewFile(step) {
+			ErrPrintf(ctx, "watch preset '%s': step %d (%s) writes a new file, which later steps wouldn't see; only the last step may write new files\n", p.preset, i+1, step.Command)
+			return subcommands.ExitFailure
+		}
+	}
+
+	root, err := filepath.Abs(f.Arg(0))
+	if err != nil {
+		ErrPrintf(ctx, "failed to find absolute path for '%s': %s\n", f.Arg(0), err)
+		return subcommands.ExitFailure
+	}
+	if stat, err := os.Stat(root); err != nil {
+		ErrPrintf(ctx, "bad watch directory '%s': %s\n", root, err)
+		return subcommands.ExitFailure
+	} else if !stat.IsDir() {
+		ErrPrintf(ctx, "bad watch directory '%s': is not a directory\n", root)
+		return subcommands.ExitFailure
+	}
+
+	settle := p.settle
+	if settle == 0 {
+		settle = time.Duration(preset.SettleSeconds) * time.Second
+	}
+	if settle <= 0 {
+		settle = defaultWatchSettle
+	}
+
+	extensions := make(map[string]bool)
+	presetExtensions := preset.Extensions
+	if len(presetExtensions) == 0 {
+		presetExtensions = imageExtensions
+	}
+	for _, ext := range presetExtensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions[ext] = true
+	}
+
+	if p.statePath == "" {
+		p.statePath = filepath.Join(root, watchStateFileName)
+	}
+	if p.logPath == "" {
+		p.logPath = filepath.Join(root, watchLogFileName)
+	}
+
+	xtoolBin, err := os.Executable()
+	if err != nil {
+		ErrPrintf(ctx, "failed to find the xtool executable: %s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	state, err := loadWatchState(p.statePath)
+	if err != nil {
+		ErrPrint(ctx, err)
+		return subcommands.ExitFailure
+	}
+
+	logFile, err := os.OpenFile(p.logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		ErrPrintf(ctx, "failed to open log file '%s': %s\n", p.logPath, err)
+		return subcommands.ExitFailure
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer func() { _ = logFile.Close() }()
+
+	outputs := make([]stepOutput, 0, len(steps))
+	for _, step := range steps {
+		outputs = append(outputs, newStepOutput(step, p.appConfig))
+	}
+	session := &watchSession{
+		root:       root,
+		steps:      steps,
+		outputs:    outputs,
+		extensions: extensions,
+		settle:     settle,
+		xtoolBin:   xtoolBin,
+		state:      state,
+		statePath:  p.statePath,
+		log:        log.New(logFile, "", log.LstdFlags),
+		logOut:     logFile,
+		pending:    make(map[string]pendingFile),
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("watching %s with preset '%s'; logging to %s\n", root, p.preset, p.logPath)
+	session.log.Printf("watching %s with preset '%s'", root, p.preset)
+
+	if err := session.run(ctx); err != nil {
+		session.log.Printf("stopped: %s", err)
+		ErrPrint(ctx, err)
+		return subcommands.ExitFailure
+	}
+
+	session.log.Printf("stopped")
+	return subcommands.ExitSuccess
+}
+
+// watchSession holds the state of a running `xtool watch`.
+// All its methods run on the goroutine that called run.
+type watchSession struct {
+	root       string
+	steps      []WatchStep
+	outputs    []stepOutput // the files each step writes, by index in steps
+	extensions map[string]bool
+	settle     time.Duration
+	xtoolBin   string
+	state      *watchState
+	statePath  string
+	log        *log.Logger
+	logOut     io.Writer
+	watcher    *dirWatcher
+	pending    map[string]pendingFile
+}
+
+// pendingFile is a file waiting for its writes to settle.
+type pendingFile struct {
+	size      int64
+	modTime   time.Time
+	changedAt time.Time
+}
+
+func (s *watchSession) run(ctx context.Context) error {
+	watcher, err := newDirWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start watching '%s': %w", s.root, err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer func() { _ = watcher.Close() }()
+	s.watcher = watcher
+
+	// Watch the whole tree, and pick up any files that arrived while xtool wasn't watching:
+	if err := s.addTree(s.root); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors():
+			s.log.Printf("watcher error: %s", err)
+		case path := <-watcher.Events():
+			s.notice(path)
+		case <-ticker.C:
+			s.processSettled(ctx)
+		}
+	}
+}
+
+// addTree watches dir and its subdirectories, except for skipped ones, and notices every file in them.
+func (s *watchSession) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != dir && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return fmt.Errorf("failed to scan '%s': %w", path, err)
+		}
+		if !d.IsDir() {
+			s.notice(path)
+			return nil
+		}
+		if path != s.root && s.skipDir(path) {
+			return filepath.SkipDir
+		}
+		if err := s.watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch '%s': %w", path, err)
+		}
+		return nil
+	})
+}
+
+// skipDir reports whether the directory should be ignored: hidden directories and
+// backups folders created by xtool under the watched tree are skipped.
+func (s *watchSession) skipDir(dir string) bool {
+	if strings.HasPrefix(filepath.Base(dir), ".") {
+		return true
+	}
+
+	// backup.ConfigFor looks up the config applicable to files in dir's parent, which is where
+	// a sub_dir backups folder would be created.
+	backupsConfig, err := backup.ConfigFor(dir)
+	if err != nil {
+		s.log.Printf("failed to get backups config for '%s': %s", dir, err)
+		return false
+	}
+	switch backupsConfig.Location {
+	case backup.LocSubDir:
+		return strings.HasPrefix(filepath.Base(dir), backupsConfig.Folder+"_")
+	case backup.LocAbsPath:
+		rel, err := filepath.Rel(backupsConfig.Folder, dir)
+		return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+	}
+	return false
+}
+
+// wants reports whether path is an image file the preset should be applied to.
+func (s *watchSession) wants(path string) bool {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	// exiftool's in-progress files and backups:
+	if strings.HasSuffix(name, "_original") || strings.HasSuffix(name, "_exiftool_tmp") {
+		return false
+	}
+	if !s.extensions[strings.ToLower(filepath.Ext(name))] {
+		return false
+	}
+	if _, ok := s.state.Outputs[s.rel(path)]; ok {
+		return false
+	}
+	return true
+}
+
+// notice records a change to path, (re)starting its settle timer if it's a file the preset wants.
+func (s *watchSession) notice(path string) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		delete(s.pending, path)
+		return
+	}
+	if stat.IsDir() {
+		if !s.skipDir(path) {
+			if err := s.addTree(path); err != nil {
+				s.log.Print(err)
+			}
+		}
+		return
+	}
+	if !stat.Mode().IsRegular() || !s.wants(path) {
+		return
+	}
+	if s.state.isCurrent(s.rel(path), stat) {
+		return
+	}
+	if prev, ok := s.pending[path]; ok && prev.size == stat.Size() && prev.modTime.Equal(stat.ModTime()) {
+		return
+	}
+	s.pending[path] = pendingFile{
+		size:      stat.Size(),
+		modTime:   stat.ModTime(),
+		changedAt: time.Now(),
+	}
+}
+
+// processSettled runs the preset on each pending file that hasn't changed for the settle duration.
+func (s *watchSession) processSettled(ctx context.Context) {
+	paths := make([]string, 0, len(s.pending))
+	for path := range s.pending {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	now := time.Now()
+	for _, path := range paths {
+		pending := s.pending[path]
+		stat, err := os.Stat(path)
+		if err != nil {
+			delete(s.pending, path)
+			continue
+		}
+		if stat.Size() != pending.size || !stat.ModTime().Equal(pending.modTime) {
+			s.pending[path] = pendingFile{
+				size:      stat.Size(),
+				modTime:   stat.ModTime(),
+				changedAt: now,
+			}
+			continue
+		}
+		if now.Sub(pending.changedAt) < s.settle {
+			continue
+		}
+
+		delete(s.pending, path)
+		s.process(ctx, path)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// process runs each step of the preset's pipeline on path, and records the result in the state file.
+func (s *watchSession) process(ctx context.Context, path string) {
+	rel := s.rel(path)
+	s.log.Printf("%s: processing", rel)
+
+	outputDirs := s.outputDirs(path)
+	before := make(map[string]map[string]bool)
+	for _, dir := range outputDirs {
+		before[dir] = listFileNames(dir)
+	}
+
+	var processErr error
+	for _, step := range s.steps {
+		args := append([]string{step.Command}, step.Args...)
+		args = append(args, path)
+		cmd := exec.CommandContext(ctx, s.xtoolBin, args...)
+		cmd.Stdout = s.logOut
+		cmd.Stderr = s.logOut
+		if err := cmd.Run(); err != nil {
+			processErr = fmt.Errorf("%s failed: %w", step.Command, err)
+			break
+		}
+	}
+	if ctx.Err() != nil {
+		// interrupted; leave the file to be processed when the watcher next runs.
+		s.log.Printf("%s: interrupted", rel)
+		return
+	}
+
+	// only new files named as a step's output for path are recorded; other new files, such as
+	// images that arrived meanwhile, are processed in turn:
+	for _, dir := range outputDirs {
+		for name := range listFileNames(dir) {
+			outPath := filepath.Join(dir, name)
+			if before[dir][name] || outPath == path || !s.isOutput(path, outPath) {
+				continue
+			}
+			s.state.Outputs[s.rel(outPath)] = rel
+			s.log.Printf("%s: wrote %s", rel, outPath)
+		}
+	}
+
+	entry := watchStateEntry{ProcessedAt: time.Now()}
+	if stat, err := os.Stat(path); err == nil {
+		entry.Size = stat.Size()
+		entry.ModTime = stat.ModTime()
+	}
+	if processErr != nil {
+		entry.Error = processErr.Error()
+		s.log.Printf("%s: %s", rel, processErr)
+	} else {
+		s.log.Printf("%s: done", rel)
+	}
+	s.state.Processed[rel] = entry
+
+	if err := s.state.save(s.statePath); err != nil {
+		s.log.Print(err)
+	}
+}
+
+// stepWritesNewFile reports whether step writes its output to a new file, rather than modifying
+// the image in place: either its command always does, or its args include -s or -d.
+func stepWritesNewFile(step WatchStep) bool {
+	if newFileCommands[step.Command] {
+		return true
+	}
+	flags := stepFlags(step.Args)
+	suffix, _ := strconv.ParseBool(flags["s"])
+	return suffix || flags["d"] != ""
+}
+
+// stepFlags returns the flags in a pipeline step's args, by name; boolean flags given without a
+// value are "true". Only -d and -c, of the flags watch reads, take a separate value.
+func stepFlags(args []string) map[string]string {
+	flags := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !hasValue {
+			value = "true"
+			if (name == "d" || name == "c") && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+		}
+		flags[name] = value
+	}
+	return flags
+}
+
+// stepOutputSuffixes are the suffixes -s names each exiftool-based command's output files with.
+var stepOutputSuffixes = map[string][]string{
+	"camswap":   {"unswap"}, // plus the camera name or alias; see newStepOutput
+	"rmloc":     {"noGPS", "coarseGPS", "relocated"},
+	"anonymize": {"anon", "unanon"},
+	"geotag":    {"geotagged"},
+	"timeshift": {"shifted", "unshifted"},
+}
+
+// stepOutput describes the files a pipeline step writes for each image, so they can be told
+// apart from new images arriving in the same directory.
+type stepOutput struct {
+	dir       string   // absolute directory outputs are written to; empty for the image's own directory
+	suffixes  []string // outputs are named like photo_suffix.jpg, for one of these suffixes
+	sameName  bool     // the output has the image's name (-d without -s)
+	appendJPG bool     // the output is named like photo.nef.jpg (preview, x3fjpg)
+	anySuffix bool     // the output is named like photo_suffix.ext, for a suffix set in Neat Image's settings (neatimg)
+}
+
+func newStepOutput(step WatchStep, appConfig AppConfig) stepOutput {
+	flags := stepFlags(step.Args)
+	var out stepOutput
+	if flags["d"] != "" {
+		if absOutDir, err := filepath.Abs(flags["d"]); err == nil {
+			out.dir = absOutDir
+		}
+	}
+	switch step.Command {
+	case "preview", "x3fjpg":
+		out.appendJPG = true
+	case "neatimg":
+		out.anySuffix = true
+	default:
+		if suffix, _ := strconv.ParseBool(flags["s"]); !suffix {
+			out.sameName = out.dir != ""
+			break
+		}
+		out.suffixes = stepOutputSuffixes[step.Command]
+		if step.Command == "camswap" {
+			var targets []string
+			if flags["c"] != "" {
+				targets = append(targets, flags["c"])
+			}
+			if auto, _ := strconv.ParseBool(flags["auto"]); auto {
+				for _, rule := range appConfig.CamswapRules {
+					targets = append(targets, rule.Alias)
+				}
+			}
+			out.suffixes = slices.Clone(out.suffixes)
+			for _, target := range targets {
+				out.suffixes = append(out.suffixes, strings.ReplaceAll(camswapSuffixName(appConfig, target), " ", "-"))
+			}
+		}
+	}
+	return out
+}
+
+// matches reports whether outPath is an output the step writes for the image at path.
+func (o stepOutput) matches(path, outPath string) bool {
+	dir := o.dir
+	if dir == "" {
+		dir = filepath.Dir(path)
+	}
+	if filepath.Dir(outPath) != dir {
+		return false
+	}
+	base, name := filepath.Base(path), filepath.Base(outPath)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	switch {
+	case o.appendJPG:
+		return name == base+".jpg"
+	case o.anySuffix:
+		return strings.HasPrefix(name, stem+"_")
+	case o.sameName:
+		return name == base
+	}
+	for _, suffix := range o.suffixes {
+		if name == stem+"_"+suffix+filepath.Ext(base) {
+			return true
+		}
+	}
+	return false
+}
+
+// isOutput reports whether outPath is an output of any of the preset's steps for path.
+func (s *watchSession) isOutput(path, outPath string) bool {
+	return slices.ContainsFunc(s.outputs, func(o stepOutput) bool { return o.matches(path, outPath) })
+}
+
+// outputDirs returns the directories the preset's steps may write output files for path into:
+// the file's own directory, plus any directory passed via -d.
+func (s *watchSession) outputDirs(path string) []string {
+	dirs := []string{filepath.Dir(path)}
+	for _, o := range s.outputs {
+		if o.dir != "" && !slices.Contains(dirs, o.dir) {
+			dirs = append(dirs, o.dir)
+		}
+	}
+	return dirs
+}
+
+func (s *watchSession) rel(path string) string {
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+func listFileNames(dir string) map[string]bool {
+	names := make(map[string]bool)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return names
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names[entry.Name()] = true
+		}
+	}
+	return names
+}
+
+// watchState is persisted between runs of `xtool watch`, so that restarts don't reprocess files.
+// Paths are relative to the watched directory.
+type watchState struct {
+	Processed map[string]watchStateEntry `json:"processed"`
+	Outputs   map[string]string          `json:"outputs"` // output file -> the file it was produced from
+}
+
+type watchStateEntry struct {
+	Size        int64     `json:"size"`     // after processing
+	ModTime     time.Time `json:"mod_time"` // after processing
+	ProcessedAt time.Time `json:"processed_at"`
+	Error       string    `json:"error,omitempty"`
+}
+
+func loadWatchState(path string) (*watchState, error) {
+	state := &watchState{
+		Processed: make(map[string]watchStateEntry),
+		Outputs:   make(map[string]string),
+	}
+	stateBytes, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read watch state file '%s': %w", path, err)
+	}
+	if err := json.Unmarshal(stateBytes, state); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s' as JSON: %w", path, err)
+	}
+	if state.Processed == nil {
+		state.Processed = make(map[string]watchStateEntry)
+	}
+	if state.Outputs == nil {
+		state.Outputs = make(map[string]string)
+	}
+	return state, nil
+}
+
+func (s *watchState) save(path string) error {
+	stateBytes, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode watch state: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, stateBytes, 0644); err != nil {
+		return fmt.Errorf("failed to write watch state file '%s': %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace watch state file '%s': %w", path, err)
+	}
+	return nil
+}
+
+// isCurrent reports whether the file was processed and hasn't changed since.
+func (s *watchState) isCurrent(rel string, stat fs.FileInfo) bool {
+	entry, ok := s.Processed[rel]
+	return ok && entry.Size == stat.Size() && entry.ModTime.Equal(stat.ModTime())
+}
@@ -0,0 +1,112 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyWatchMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO
+
+// dirWatcher reports the paths of entries created or modified in a set of directories, using inotify.
+type dirWatcher struct {
+	fd     int
+	f      *os.File
+	mu     sync.Mutex
+	dirs   map[int32]string
+	events chan string
+	errs   chan error
+	done   chan struct{}
+}
+
+func newDirWatcher() (*dirWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1 failed: %w", err)
+	}
+	w := &dirWatcher{
+		fd:     fd,
+		f:      os.NewFile(uintptr(fd), "inotify"),
+		dirs:   make(map[int32]string),
+		events: make(chan string, 64),
+		errs:   make(chan error, 8),
+		done:   make(chan struct{}),
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+// Add starts watching dir (but not its subdirectories).
+func (w *dirWatcher) Add(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyWatchMask)
+	if err != nil {
+		return fmt.Errorf("inotify_add_watch failed: %w", err)
+	}
+	w.dirs[int32(wd)] = dir
+	return nil
+}
+
+func (w *dirWatcher) Events() <-chan string { return w.events }
+func (w *dirWatcher) Errors() <-chan error  { return w.errs }
+
+func (w *dirWatcher) Close() error {
+	close(w.done)
+	return w.f.Close()
+}
+
+func (w *dirWatcher) readEvents() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.sendErr(fmt.Errorf("failed to read inotify events: %w", err))
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[nameStart:nameStart+int(event.Len)]), "\x00")
+			offset = nameStart + int(event.Len)
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				w.sendErr(errors.New("inotify event queue overflowed; some new files may have been missed"))
+				continue
+			}
+
+			w.mu.Lock()
+			dir, ok := w.dirs[event.Wd]
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				delete(w.dirs, event.Wd)
+			}
+			w.mu.Unlock()
+			if !ok || name == "" {
+				continue
+			}
+
+			select {
+			case w.events <- filepath.Join(dir, name):
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+func (w *dirWatcher) sendErr(err error) {
+	select {
+	case w.errs <- err:
+	default:
+	}
+}
@@ -0,0 +1,136 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const dirPollInterval = 2 * time.Second
+
+// dirWatcher reports the paths of entries created or modified in a set of directories,
+// by listing them periodically.
+type dirWatcher struct {
+	mu     sync.Mutex
+	dirs   map[string]map[string]dirEntryStamp
+	events chan string
+	errs   chan error
+	done   chan struct{}
+}
+
+type dirEntryStamp struct {
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+func newDirWatcher() (*dirWatcher, error) {
+	w := &dirWatcher{
+		dirs:   make(map[string]map[string]dirEntryStamp),
+		events: make(chan string, 64),
+		errs:   make(chan error, 8),
+		done:   make(chan struct{}),
+	}
+	go w.poll()
+	return w, nil
+}
+
+// Add starts watching dir (but not its subdirectories).
+func (w *dirWatcher) Add(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.dirs[dir]; !ok {
+		w.dirs[dir] = make(map[string]dirEntryStamp)
+	}
+	return nil
+}
+
+func (w *dirWatcher) Events() <-chan string { return w.events }
+func (w *dirWatcher) Errors() <-chan error  { return w.errs }
+
+func (w *dirWatcher) Close() error {
+	close(w.done)
+	return nil
+}
+
+func (w *dirWatcher) poll() {
+	ticker := time.NewTicker(dirPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		w.mu.Lock()
+		dirs := make([]string, 0, len(w.dirs))
+		for dir := range w.dirs {
+			dirs = append(dirs, dir)
+		}
+		w.mu.Unlock()
+
+		for _, dir := range dirs {
+			for _, path := range w.scan(dir) {
+				select {
+				case w.events <- path:
+				case <-w.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+// scan lists dir and returns the paths of files that are new or changed since the last scan,
+// and of directories that are new since the last scan.
+func (w *dirWatcher) scan(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		w.mu.Lock()
+		delete(w.dirs, dir)
+		w.mu.Unlock()
+		if !os.IsNotExist(err) {
+			w.sendErr(fmt.Errorf("failed to list '%s': %w", dir, err))
+		}
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	prevStamps := w.dirs[dir]
+	stamps := make(map[string]dirEntryStamp, len(entries))
+	var changed []string
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		stamp := dirEntryStamp{isDir: entry.IsDir()}
+		if !stamp.isDir {
+			stamp.size = info.Size()
+			stamp.modTime = info.ModTime()
+		}
+		stamps[entry.Name()] = stamp
+		if prev, ok := prevStamps[entry.Name()]; !ok || !prev.equal(stamp) {
+			changed = append(changed, filepath.Join(dir, entry.Name()))
+		}
+	}
+	w.dirs[dir] = stamps
+	return changed
+}
+
+func (s dirEntryStamp) equal(other dirEntryStamp) bool {
+	return s.isDir == other.isDir && s.size == other.size && s.modTime.Equal(other.modTime)
+}
+
+func (w *dirWatcher) sendErr(err error) {
+	select {
+	case w.errs <- err:
+	default:
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"xtool/camswap"
+)
+
+func TestStepOutputMatches(t *testing.T) {
+	appConfig := AppConfig{
+		CamswapAliases: map[string]camswap.Profile{
+			"sfp": {Model: "SIGMA fp", Suffix: "sigma fp"},
+		},
+		CamswapRules: []camswap.Rule{{Alias: "Z 6"}},
+	}
+	dir := filepath.Join(string(filepath.Separator), "photos")
+	outDir, err := filepath.Abs("previews")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "IMG_1.JPG")
+
+	for _, tc := range []struct {
+		name    string
+		step    WatchStep
+		outPath string
+		want    bool
+	}{
+		{"rmloc -s", WatchStep{"rmloc", []string{"-s"}}, filepath.Join(dir, "IMG_1_noGPS.JPG"), true},
+		{"rmloc -s, coarsened", WatchStep{"rmloc", []string{"-coarsen", "0.1", "-s"}}, filepath.Join(dir, "IMG_1_coarseGPS.JPG"), true},
+		{"rmloc -s, another image", WatchStep{"rmloc", []string{"-s"}}, filepath.Join(dir, "IMG_10.JPG"), false},
+		{"rmloc -s, the image's twin", WatchStep{"rmloc", []string{"-s"}}, filepath.Join(dir, "IMG_1.NEF"), false},
+		{"rmloc -s, other extension", WatchStep{"rmloc", []string{"-s"}}, filepath.Join(dir, "IMG_1_noGPS.NEF"), false},
+		{"rmloc in place", WatchStep{"rmloc", nil}, filepath.Join(dir, "IMG_1_noGPS.JPG"), false},
+		{"rmloc -d", WatchStep{"rmloc", []string{"-d", "previews"}}, filepath.Join(outDir, "IMG_1.JPG"), true},
+		{"rmloc -d=", WatchStep{"rmloc", []string{"-d=previews"}}, filepath.Join(outDir, "IMG_1.JPG"), true},
+		{"rmloc -d, another image", WatchStep{"rmloc", []string{"-d", "previews"}}, filepath.Join(outDir, "IMG_10.JPG"), false},
+		{"rmloc -d, the image's own directory", WatchStep{"rmloc", []string{"-d", "previews"}}, filepath.Join(dir, "IMG_1.JPG"), false},
+		{"rmloc -d -s", WatchStep{"rmloc", []string{"-d", "previews", "-s"}}, filepath.Join(outDir, "IMG_1_noGPS.JPG"), true},
+		{"camswap alias suffix", WatchStep{"camswap", []string{"-c", "sfp", "-s"}}, filepath.Join(dir, "IMG_1_sigma-fp.JPG"), true},
+		{"camswap model", WatchStep{"camswap", []string{"-c=X100V", "-s"}}, filepath.Join(dir, "IMG_1_X100V.JPG"), true},
+		{"camswap -auto", WatchStep{"camswap", []string{"-auto", "-s"}}, filepath.Join(dir, "IMG_1_Z-6.JPG"), true},
+		{"camswap, other model", WatchStep{"camswap", []string{"-c", "sfp", "-s"}}, filepath.Join(dir, "IMG_1_X100V.JPG"), false},
+		{"preview", WatchStep{"preview", nil}, filepath.Join(dir, "IMG_1.JPG.jpg"), true},
+		{"preview -d", WatchStep{"preview", []string{"-rotate", "-d", "previews"}}, filepath.Join(outDir, "IMG_1.JPG.jpg"), true},
+		{"preview, another image", WatchStep{"preview", nil}, filepath.Join(dir, "IMG_10.JPG.jpg"), false},
+		{"neatimg", WatchStep{"neatimg", nil}, filepath.Join(dir, "IMG_1_filtered.tif"), true},
+		{"neatimg, another image", WatchStep{"neatimg", nil}, filepath.Join(dir, "IMG_10.JPG"), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := newStepOutput(tc.step, appConfig).matches(path, tc.outPath); got != tc.want {
+				t.Errorf("matches(%s) = %v; want %v", tc.outPath, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStepWritesNewFile(t *testing.T) {
+	for _, tc := range []struct {
+		step WatchStep
+		want bool
+	}{
+		{WatchStep{"rmloc", nil}, false},
+		{WatchStep{"camswap", []string{"-c", "sfp"}}, false},
+		{WatchStep{"rmloc", []string{"-s"}}, true},
+		{WatchStep{"rmloc", []string{"--s=true"}}, true},
+		{WatchStep{"rmloc", []string{"-s=false"}}, false},
+		{WatchStep{"rmloc", []string{"-d", "out"}}, true},
+		{WatchStep{"rmloc", []string{"-d="}}, false},
+		{WatchStep{"neatimg", nil}, true},
+	} {
+		if got := stepWritesNewFile(tc.step); got != tc.want {
+			t.Errorf("stepWritesNewFile(%v) = %v; want %v", tc.step, got, tc.want)
+		}
+	}
+}
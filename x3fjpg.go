@@ -48,33 +48,11 @@ func (p *x3fJpgCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface
 
 	p.appConfig = AppConfigFromCtx(ctx)
 
-	// We try to find x3f_extract here instead of when validating the config to allow this program
-	// to work in the (common!) case where the user is not concerned with X3F files.
-
-	// Try finding x3f_extract in the path if it wasn't specified in a config:
-	if p.appConfig.GetX3fExtractBin() == "" {
-		if stat, err := os.Stat(LocalX3fExtractPath()); err == nil {
-			if IsExecAny(stat.Mode()) {
-				p.appConfig.X3fExtractBin = LocalX3fExtractPath()
-			}
-		}
-	}
-	// Fallback to finding x3f_extract in the path if it wasn't specified in a config or located in ~/.local/bin:
-	if p.appConfig.GetX3fExtractBin() == "" {
-		x3fBin, err := exec.LookPath("x3f_extract")
-		if err != nil {
-			ErrPrintln(ctx, "x3f_extract_bin was not specified in config and x3f_extract is missing from $PATH")
-			ErrPrintf(ctx, "$PATH search failed with: %s\n", err)
-			return subcommands.ExitFailure
-		}
-		p.appConfig.X3fExtractBin = x3fBin
+	if !findX3fExtract(ctx, &p.appConfig) {
+		return subcommands.ExitFailure
 	}
 
-	x3fArgs := []string{"-jpg"}
-
 	if p.outDir != "" {
-		x3fArgs = append(x3fArgs, "-o", p.outDir)
-
 		// prep output directory:
 		err := os.MkdirAll(p.outDir, 0777)
 		if err != nil {
@@ -82,11 +60,7 @@ func (p *x3fJpgCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface
 			return subcommands.ExitFailure
 		}
 	}
-	if !p.verbose {
-		x3fArgs = append(x3fArgs, "-q")
-	} else if p.verbose2 {
-		x3fArgs = append(x3fArgs, "-v")
-	}
+	x3fArgs := x3fJpgArgs(p.outDir, p.verbose, p.verbose2)
 
 	successes, failures := X3fJpgProcess(
 		x3fArgs,
@@ -112,6 +86,48 @@ func (p *x3fJpgCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface
 	return subcommands.ExitSuccess
 }
 
+// findX3fExtract sets appConfig.X3fExtractBin, if it wasn't given in config, to x3f_extract in
+// ~/.local/bin or else $PATH. It prints an error and returns false if x3f_extract can't be found.
+func findX3fExtract(ctx context.Context, appConfig *AppConfig) bool {
+	// We try to find x3f_extract here instead of when validating the config to allow this program
+	// to work in the (common!) case where the user is not concerned with X3F files.
+
+	// Try finding x3f_extract in the path if it wasn't specified in a config:
+	if appConfig.GetX3fExtractBin() == "" {
+		if stat, err := os.Stat(LocalX3fExtractPath()); err == nil {
+			if IsExecAny(stat.Mode()) {
+				appConfig.X3fExtractBin = LocalX3fExtractPath()
+			}
+		}
+	}
+	// Fallback to finding x3f_extract in the path if it wasn't specified in a config or located in ~/.local/bin:
+	if appConfig.GetX3fExtractBin() == "" {
+		x3fBin, err := exec.LookPath("x3f_extract")
+		if err != nil {
+			ErrPrintln(ctx, "x3f_extract_bin was not specified in config and x3f_extract is missing from $PATH")
+			ErrPrintf(ctx, "$PATH search failed with: %s\n", err)
+			return false
+		}
+		appConfig.X3fExtractBin = x3fBin
+	}
+	return true
+}
+
+// x3fJpgArgs returns the x3f_extract arguments that extract X3F files' embedded JPEGs to outDir,
+// or alongside the X3F files if outDir is empty.
+func x3fJpgArgs(outDir string, verbose, verbose2 bool) []string {
+	x3fArgs := []string{"-jpg"}
+	if outDir != "" {
+		x3fArgs = append(x3fArgs, "-o", outDir)
+	}
+	if !verbose {
+		x3fArgs = append(x3fArgs, "-q")
+	} else if verbose2 {
+		x3fArgs = append(x3fArgs, "-v")
+	}
+	return x3fArgs
+}
+
 // X3fJpgProcess returns list of files successfully processed, and map of filename -> error.
 func X3fJpgProcess(args []string, files []string, appConfig AppConfig, verbose, verbose2 bool) ([]string, map[string]error) {
 	errorPrintln := color.New(color.FgRed).PrintlnFunc()